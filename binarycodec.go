@@ -0,0 +1,359 @@
+package gocqrs
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+)
+
+// errBinaryTruncated is returned when binary encoded data ends in the middle of a value.
+var errBinaryTruncated = errors.New("gocqrs: binary codec: unexpected end of data")
+
+var (
+	// binaryMarshalerType is the reflect type of encoding.BinaryMarshaler
+	binaryMarshalerType = reflect.TypeFor[encoding.BinaryMarshaler]()
+	// binaryUnmarshalerType is the reflect type of encoding.BinaryUnmarshaler
+	binaryUnmarshalerType = reflect.TypeFor[encoding.BinaryUnmarshaler]()
+)
+
+// binaryCodec is the Codec behind BinaryCodec. Values are written without names or type information:
+// integers as varints, floats as little-endian IEEE 754, strings and byte slices with a length prefix,
+// and the exported fields of structs in declaration order. Slices, maps and pointers carry a prefix telling nil
+// from empty, map entries are sorted so equal maps encode to equal bytes. Types implementing both
+// encoding.BinaryMarshaler and encoding.BinaryUnmarshaler, such as time.Time, are encoded with them.
+// Interfaces, channels and functions are rejected.
+type binaryCodec struct{}
+
+// Name returns "binary".
+func (binaryCodec) Name() string {
+	return "binary"
+}
+
+// Marshal encodes the value in the compact binary format.
+func (binaryCodec) Marshal(v any) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return nil, errors.New("gocqrs: binary codec: cannot encode nil")
+	}
+	// Encode an addressable copy, so marshalers with pointer receivers are found
+	addressable := reflect.New(rv.Type()).Elem()
+	addressable.Set(rv)
+	return appendBinary(nil, addressable)
+}
+
+// Unmarshal decodes data in the compact binary format into the value v points to.
+func (binaryCodec) Unmarshal(data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("gocqrs: binary codec: cannot decode into %T, need a non-nil pointer", v)
+	}
+	d := binaryDecoder{data: data}
+	if err := d.value(rv.Elem()); err != nil {
+		return err
+	}
+	if len(d.data) > 0 {
+		return fmt.Errorf("gocqrs: binary codec: %d bytes left after %s", len(d.data), rv.Elem().Type())
+	}
+	return nil
+}
+
+// appendBinary appends the encoding of v to buf.
+func appendBinary(buf []byte, v reflect.Value) ([]byte, error) {
+	if v.CanAddr() && usesBinaryMarshaler(v.Type()) {
+		data, err := v.Addr().Interface().(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		return append(binary.AppendUvarint(buf, uint64(len(data))), data...), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return append(buf, 1), nil
+		}
+		return append(buf, 0), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return binary.AppendVarint(buf, v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return binary.AppendUvarint(buf, v.Uint()), nil
+	case reflect.Float32:
+		return binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(v.Float()))), nil
+	case reflect.Float64:
+		return binary.LittleEndian.AppendUint64(buf, math.Float64bits(v.Float())), nil
+	case reflect.String:
+		return append(binary.AppendUvarint(buf, uint64(v.Len())), v.String()...), nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return append(buf, 0), nil
+		}
+		buf = binary.AppendUvarint(buf, uint64(v.Len())+1)
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return append(buf, v.Bytes()...), nil
+		}
+		return appendBinaryElements(buf, v)
+	case reflect.Array:
+		return appendBinaryElements(buf, v)
+	case reflect.Map:
+		if v.IsNil() {
+			return append(buf, 0), nil
+		}
+		return appendBinaryMap(binary.AppendUvarint(buf, uint64(v.Len())+1), v)
+	case reflect.Struct:
+		for i := range v.NumField() {
+			if !v.Type().Field(i).IsExported() {
+				continue
+			}
+			var err error
+			if buf, err = appendBinary(buf, v.Field(i)); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case reflect.Pointer:
+		if v.IsNil() {
+			return append(buf, 0), nil
+		}
+		return appendBinary(append(buf, 1), v.Elem())
+	default:
+		return nil, fmt.Errorf("gocqrs: binary codec: cannot encode %s", v.Type())
+	}
+}
+
+// usesBinaryMarshaler reports whether values of type t are encoded with their own binary marshaling methods.
+// Both directions must be implemented, otherwise the codec could not decode what it encoded.
+func usesBinaryMarshaler(t reflect.Type) bool {
+	p := reflect.PointerTo(t)
+	return t.Kind() != reflect.Pointer && p.Implements(binaryMarshalerType) && p.Implements(binaryUnmarshalerType)
+}
+
+// appendBinaryElements appends the encoding of every element of the slice or array v to buf.
+func appendBinaryElements(buf []byte, v reflect.Value) ([]byte, error) {
+	for i := range v.Len() {
+		var err error
+		if buf, err = appendBinary(buf, v.Index(i)); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// appendBinaryMap appends the entries of the map v to buf, ordered by their encoded keys.
+func appendBinaryMap(buf []byte, v reflect.Value) ([]byte, error) {
+	type entry struct {
+		key, value []byte
+	}
+	entries := make([]entry, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		// Map keys and values are not addressable, copy them so marshalers with pointer receivers are found
+		key, value := reflect.New(v.Type().Key()).Elem(), reflect.New(v.Type().Elem()).Elem()
+		key.Set(iter.Key())
+		value.Set(iter.Value())
+		k, err := appendBinary(nil, key)
+		if err != nil {
+			return nil, err
+		}
+		e, err := appendBinary(nil, value)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry{key: k, value: e})
+	}
+	slices.SortFunc(entries, func(a, b entry) int {
+		return bytes.Compare(a.key, b.key)
+	})
+	for _, e := range entries {
+		buf = append(append(buf, e.key...), e.value...)
+	}
+	return buf, nil
+}
+
+// binaryDecoder decodes values from the remaining data.
+type binaryDecoder struct {
+	// data holds the bytes not decoded yet
+	data []byte
+}
+
+// value decodes the next value into v, which must be addressable.
+func (d *binaryDecoder) value(v reflect.Value) error {
+	if usesBinaryMarshaler(v.Type()) {
+		data, err := d.bytes()
+		if err != nil {
+			return err
+		}
+		return v.Addr().Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(slices.Clone(data))
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		b, err := d.next(1)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b[0] != 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, size := binary.Varint(d.data)
+		if size <= 0 {
+			return errBinaryTruncated
+		}
+		d.data = d.data[size:]
+		if v.OverflowInt(n) {
+			return fmt.Errorf("gocqrs: binary codec: %d overflows %s", n, v.Type())
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := d.uvarint()
+		if err != nil {
+			return err
+		}
+		if v.OverflowUint(n) {
+			return fmt.Errorf("gocqrs: binary codec: %d overflows %s", n, v.Type())
+		}
+		v.SetUint(n)
+	case reflect.Float32:
+		b, err := d.next(4)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(b))))
+	case reflect.Float64:
+		b, err := d.next(8)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(math.Float64frombits(binary.LittleEndian.Uint64(b)))
+	case reflect.String:
+		b, err := d.bytes()
+		if err != nil {
+			return err
+		}
+		v.SetString(string(b))
+	case reflect.Slice:
+		return d.slice(v)
+	case reflect.Array:
+		for i := range v.Len() {
+			if err := d.value(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		return d.mapEntries(v)
+	case reflect.Struct:
+		for i := range v.NumField() {
+			if !v.Type().Field(i).IsExported() {
+				continue
+			}
+			if err := d.value(v.Field(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Pointer:
+		b, err := d.next(1)
+		if err != nil {
+			return err
+		}
+		if b[0] == 0 {
+			v.SetZero()
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.value(v.Elem())
+	default:
+		return fmt.Errorf("gocqrs: binary codec: cannot decode %s", v.Type())
+	}
+	return nil
+}
+
+// slice decodes a nil flag and length followed by the elements into the slice v.
+func (d *binaryDecoder) slice(v reflect.Value) error {
+	n, err := d.uvarint()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		v.SetZero()
+		return nil
+	}
+	n--
+	if v.Type().Elem().Kind() == reflect.Uint8 {
+		b, err := d.next(n)
+		if err != nil {
+			return err
+		}
+		v.SetBytes(slices.Clone(b))
+		return nil
+	}
+	// Every element takes at least a byte in practice, do not trust the length beyond the remaining data
+	s := reflect.MakeSlice(v.Type(), 0, int(min(n, uint64(len(d.data)))))
+	for range n {
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if err := d.value(elem); err != nil {
+			return err
+		}
+		s = reflect.Append(s, elem)
+	}
+	v.Set(s)
+	return nil
+}
+
+// mapEntries decodes a nil flag and length followed by the entries into the map v.
+func (d *binaryDecoder) mapEntries(v reflect.Value) error {
+	n, err := d.uvarint()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		v.SetZero()
+		return nil
+	}
+	m := reflect.MakeMapWithSize(v.Type(), int(min(n-1, uint64(len(d.data)))))
+	for range n - 1 {
+		key, value := reflect.New(v.Type().Key()).Elem(), reflect.New(v.Type().Elem()).Elem()
+		if err := d.value(key); err != nil {
+			return err
+		}
+		if err := d.value(value); err != nil {
+			return err
+		}
+		m.SetMapIndex(key, value)
+	}
+	v.Set(m)
+	return nil
+}
+
+// uvarint decodes an unsigned varint.
+func (d *binaryDecoder) uvarint() (uint64, error) {
+	n, size := binary.Uvarint(d.data)
+	if size <= 0 {
+		return 0, errBinaryTruncated
+	}
+	d.data = d.data[size:]
+	return n, nil
+}
+
+// bytes decodes a length-prefixed byte sequence, the result aliases the data.
+func (d *binaryDecoder) bytes() ([]byte, error) {
+	n, err := d.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	return d.next(n)
+}
+
+// next consumes the next n bytes, the result aliases the data.
+func (d *binaryDecoder) next(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)) {
+		return nil, errBinaryTruncated
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b, nil
+}
@@ -0,0 +1,78 @@
+package gocqrs
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+)
+
+// Codec encodes event values to bytes and back.
+// Implementations must be safe for concurrent use.
+type Codec interface {
+	// Name identifies the codec in stored events, so they are decoded with the codec they were encoded with.
+	Name() string
+
+	// Marshal encodes the value.
+	Marshal(v any) ([]byte, error)
+
+	// Unmarshal decodes data into the value v points to.
+	Unmarshal(data []byte, v any) error
+}
+
+var (
+	// JSONCodec encodes events as JSON using encoding/json. It is the default codec,
+	// file-based stores embed its output as is, which keeps their files readable.
+	JSONCodec Codec = jsonCodec{}
+	// GobCodec encodes events using encoding/gob. Every payload carries its own type description.
+	GobCodec Codec = gobCodec{}
+	// BinaryCodec encodes events in a compact binary format without field names, see binaryCodec.
+	// Events must be decoded into the same struct layout they were encoded from.
+	BinaryCodec Codec = binaryCodec{}
+)
+
+// codecs holds the built-in codecs by name.
+var codecs = map[string]Codec{
+	JSONCodec.Name():   JSONCodec,
+	GobCodec.Name():    GobCodec,
+	BinaryCodec.Name(): BinaryCodec,
+}
+
+// jsonCodec is the Codec behind JSONCodec.
+type jsonCodec struct{}
+
+// Name returns "json".
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+// Marshal encodes the value as JSON.
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes JSON data into the value v points to.
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// gobCodec is the Codec behind GobCodec.
+type gobCodec struct{}
+
+// Name returns "gob".
+func (gobCodec) Name() string {
+	return "gob"
+}
+
+// Marshal encodes the value as a self-describing gob stream.
+func (gobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes gob data into the value v points to.
+func (gobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
@@ -0,0 +1,95 @@
+package gocqrs
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type codecSample struct {
+	Name     string
+	Count    int
+	Small    int8
+	Unsigned uint32
+	Ratio    float64
+	Enabled  bool
+	Tags     []string
+	Raw      []byte
+	Scores   map[string]int
+	Nested   *codecSample
+	Fixed    [2]uint16
+	At       time.Time
+	private  string
+}
+
+func TestCodecsRoundTrip(t *testing.T) {
+	sample := codecSample{
+		Name:     "sample",
+		Count:    -42,
+		Small:    -8,
+		Unsigned: 1 << 31,
+		Ratio:    0.25,
+		Enabled:  true,
+		Tags:     []string{"a", "b"},
+		Raw:      []byte{0, 1, 2},
+		Scores:   map[string]int{"x": 1, "y": 2},
+		Nested:   &codecSample{Name: "nested", Tags: []string{}},
+		Fixed:    [2]uint16{7, 9},
+		At:       time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+		private:  "dropped",
+	}
+	expected := sample
+	expected.private = ""
+
+	for _, codec := range []Codec{JSONCodec, GobCodec, BinaryCodec} {
+		t.Run(codec.Name(), func(t *testing.T) {
+			data, err := codec.Marshal(sample)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			var decoded codecSample
+			if err := codec.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if !decoded.At.Equal(expected.At) {
+				t.Errorf("Expected time %v, got %v", expected.At, decoded.At)
+			}
+			decoded.At = expected.At
+			if codec != BinaryCodec {
+				// Only the binary codec tells empty from nil slices
+				decoded.Nested.Tags = expected.Nested.Tags
+			}
+			if !reflect.DeepEqual(decoded, expected) {
+				t.Errorf("Expected %+v, got %+v", expected, decoded)
+			}
+		})
+	}
+}
+
+func TestBinaryCodec(t *testing.T) {
+	first, _ := BinaryCodec.Marshal(map[string]int{"a": 1, "b": 2, "c": 3})
+	second, _ := BinaryCodec.Marshal(map[string]int{"c": 3, "b": 2, "a": 1})
+	if string(first) != string(second) {
+		t.Error("Expected equal maps to encode to equal bytes")
+	}
+
+	data, _ := BinaryCodec.Marshal(testEvent{Name: "binary"})
+	if len(data) != len("binary")+1 {
+		t.Errorf("Expected only the length and the string, got %d bytes", len(data))
+	}
+	var e testEvent
+	if err := BinaryCodec.Unmarshal(data[:3], &e); err != errBinaryTruncated {
+		t.Errorf("Expected truncated data to fail, got %v", err)
+	}
+	if err := BinaryCodec.Unmarshal(append(data, 0), &e); err == nil {
+		t.Error("Expected trailing data to fail")
+	}
+	var small int8
+	big, _ := BinaryCodec.Marshal(1000)
+	if err := BinaryCodec.Unmarshal(big, &small); err == nil {
+		t.Error("Expected overflowing value to fail")
+	}
+	if _, err := BinaryCodec.Marshal(struct{ Any any }{Any: 1}); err == nil {
+		t.Error("Expected interface field to be rejected")
+	}
+}
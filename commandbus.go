@@ -1,6 +1,16 @@
 package gocqrs
 
-import "reflect"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
 // Command represents any command object that can be handled by a CommandHandler.
 // Commands are write operations that modify system state and may trigger side effects.
@@ -22,80 +32,673 @@ type CommandHandler interface {
 	CollectEvents() []Event
 }
 
+// FallibleCommandHandler is an optional interface a CommandHandler can implement to report failures.
+// When a registered handler implements it, the command bus calls TryHandle instead of Handle
+// and returns the error to callers of TryExecute, wrapped with ErrHandlerFailed.
+type FallibleCommandHandler interface {
+	CommandHandler
+
+	// TryHandle processes the given command like Handle but may return an error.
+	// Events are only collected from the returned handler when the error is nil.
+	TryHandle(c Command) (CommandHandler, error)
+}
+
+// ContextCommandHandler is an optional interface a CommandHandler can implement to receive the context.
+// When a registered handler implements it, the command bus calls HandleContext instead of Handle or TryHandle,
+// passing the context given to ExecuteContext or DispatchContext.
+type ContextCommandHandler interface {
+	CommandHandler
+
+	// HandleContext processes the given command within the given context and may return an error.
+	// Handlers should honour cancellation and deadlines of the context where possible.
+	// Events are only collected from the returned handler when the error is nil.
+	HandleContext(ctx context.Context, c Command) (CommandHandler, error)
+}
+
+// EventClearer is an optional interface a CommandHandler can implement to discard its collected events.
+// When a shared handler instance implements it, the command bus calls ClearEvents after collecting the events
+// of every execution, whether it succeeded or not, so events are never dispatched twice.
+type EventClearer interface {
+	// ClearEvents discards all events collected so far.
+	ClearEvents()
+}
+
+// CommandHandlerFactory creates a fresh CommandHandler for every execution of a command.
+// Registering a factory isolates executions from each other, so handlers can keep events
+// and other state in fields without leaking them into later or concurrent executions:
+//
+//	bus.Register(RegisterCommand{}, gocqrs.CommandHandlerFactory(func() gocqrs.CommandHandler {
+//		return &RegisterCommandHandler{}
+//	}))
+type CommandHandlerFactory func() CommandHandler
+
+// Handle creates a new handler and lets it process the command.
+// The returned handler is the new instance, holding only the events of this execution.
+func (f CommandHandlerFactory) Handle(c Command) CommandHandler {
+	return f().Handle(c)
+}
+
+// CollectEvents returns no events, the events of an execution are collected from the handler returned by Handle.
+func (f CommandHandlerFactory) CollectEvents() []Event {
+	return nil
+}
+
+// HandleContext creates a new handler and lets it process the command within the given context.
+// The handler is called through its most capable handle method.
+func (f CommandHandlerFactory) HandleContext(ctx context.Context, c Command) (CommandHandler, error) {
+	return invokeCommandHandler(ctx, f(), c)
+}
+
+// isolated marks CommandHandlerFactory as creating a separate handler per execution.
+func (f CommandHandlerFactory) isolated() {}
+
+// isolatedCommandHandler is implemented by handlers that keep no state between executions.
+// The command bus does not serialize executions of such handlers.
+type isolatedCommandHandler interface {
+	isolated()
+}
+
 // CommandBus defines the interface for a command bus that handles write operations.
 // It provides methods to execute commands synchronously or asynchronously and register command handlers.
+// Every method sending a command also accepts a CommandEnvelope that wraps the command with metadata.
 type CommandBus interface {
 	// Dispatch executes a command asynchronously in a separate goroutine.
 	// Use this for fire-and-forget operations or when you don't need to wait.
 	// Any domain events produced will be dispatched to the event bus.
+	// Panics if no handler is registered for the command type.
 	Dispatch(c Command)
 
+	// TryDispatch executes a command asynchronously like Dispatch.
+	// Returns ErrNoHandler instead of panicking if no handler is registered for the command type.
+	TryDispatch(c Command) error
+
+	// DispatchContext executes a command asynchronously like TryDispatch.
+	// The handlers receive a context that carries the values of ctx but is not cancelled with it,
+	// so background work outlives the request that started it.
+	DispatchContext(ctx context.Context, c Command) error
+
+	// DispatchAsync executes a command asynchronously like DispatchContext and returns a Future
+	// that delivers the outcome, so callers can opt into awaiting it with Future.Wait.
+	// Dispatch errors such as ErrNoHandler are delivered through the Future as well.
+	DispatchAsync(ctx context.Context, c Command) *Future
+
 	// Execute executes a command synchronously and waits for completion.
 	// Use this when you need to ensure the command has finished executing.
 	// Any domain events produced will be dispatched to the event bus.
+	// Panics if the command could not be handled.
 	Execute(c Command)
 
+	// TryExecute executes a command synchronously like Execute and reports failures as errors.
+	// Returns ErrNoHandler if no handler is registered for the command type,
+	// or an error wrapping ErrHandlerFailed if a handler failed.
+	TryExecute(c Command) error
+
+	// ExecuteContext executes a command synchronously like TryExecute within the given context.
+	// Returns the context's error if it is done before all handlers have run.
+	ExecuteContext(ctx context.Context, c Command) error
+
 	// Register associates a command type with its corresponding handler.
-	// The command parameter is used to determine the type name for registration.
+	// The command parameter is used to determine the type for registration,
+	// a command and a pointer to it share the same handlers.
 	// Multiple handlers can be registered per command type.
+	// A shared handler instance should implement EventClearer: otherwise the bus skips the events of earlier
+	// executions but cannot discard them, so the handler keeps every event it ever collected.
+	// Panics if the command is nil or not of a named type.
 	Register(c Command, ch CommandHandler)
+
+	// TryRegister associates a command type with its corresponding handler like Register.
+	// Returns ErrInvalidType instead of panicking if the command cannot be used for registration.
+	TryRegister(c Command, ch CommandHandler) error
+
+	// Unregister removes all handlers registered for the type of the given command.
+	// Commands executed afterwards fail with ErrNoHandler until a new handler is registered.
+	// Executions that already started are allowed to complete.
+	Unregister(c Command)
+
+	// Shutdown stops accepting asynchronous commands, drains the queued ones and waits for running handlers
+	// until ctx is done. Asynchronous dispatches afterwards fail with ErrClosed.
+	// Returns a *ShutdownError describing the abandoned work if ctx ends first.
+	Shutdown(ctx context.Context) error
+
+	// Close shuts the bus down like Shutdown, waiting without a deadline.
+	Close() error
+}
+
+// commandRegistry holds the handlers and middleware of a command bus.
+// A registry is never modified once published, changes are made on a clone.
+type commandRegistry struct {
+	// handlers maps command types to their corresponding handler registrations
+	handlers map[reflect.Type][]*commandRegistration
+	// middleware wraps the handling of every command, in registration order
+	middleware []CommandMiddleware
+	// typeMiddleware maps command types to middleware that only wraps commands of that type
+	typeMiddleware map[reflect.Type][]CommandMiddleware
+	// limits maps command types to the limiters bounding their concurrent executions
+	limits map[reflect.Type]*concurrencyLimiter
+	// pool executes asynchronously dispatched commands
+	pool *WorkerPool
+	// errorHook receives failures of fire-and-forget commands, nil to log them
+	errorHook ErrorHook
+	// unitOfWork determines whether events are only published once all handlers of a command succeeded
+	unitOfWork bool
+	// transactionHook begins the transaction of each command in unit-of-work mode, nil for none
+	transactionHook TransactionHook
+	// outbox stores the collected events for publication by an OutboxRelay, nil to publish them directly
+	outbox OutboxStore
+	// eventStore persists the collected events before they are published, nil to only publish them
+	eventStore EventStore
+}
+
+// clone returns a copy of the registry that can be modified without affecting readers of the original.
+// Slices are shared, so they must only be extended with appendCopy.
+func (r *commandRegistry) clone() *commandRegistry {
+	return &commandRegistry{
+		handlers:       maps.Clone(r.handlers),
+		middleware:     r.middleware,
+		typeMiddleware: maps.Clone(r.typeMiddleware),
+		limits:         maps.Clone(r.limits),
+		pool:           r.pool,
+		errorHook:      r.errorHook,
+
+		unitOfWork:      r.unitOfWork,
+		transactionHook: r.transactionHook,
+		outbox:          r.outbox,
+		eventStore:      r.eventStore,
+	}
 }
 
 // defaultCommandBus is the default implementation of CommandBus.
 // It uses reflection to map command types to their handlers and integrates with an event bus.
+// It is safe for concurrent registration and dispatch.
 type defaultCommandBus struct {
 	// EventBus is used to dispatch domain events produced by command handlers
 	EventBus EventBus
-	// handlers maps command type names to their corresponding handlers
-	handlers map[string][]CommandHandler
+	// mu serializes changes to the registry
+	mu sync.Mutex
+	// registry holds the current handlers and middleware and is replaced as a whole on every change
+	registry atomic.Pointer[commandRegistry]
+	// work tracks asynchronously dispatched commands for shutdown
+	work lifecycle
 }
 
 // Dispatch executes the given command asynchronously in a new goroutine.
 // It finds the registered handler, executes the command, and dispatches any resulting events.
 // Note: This method returns immediately without waiting for command completion.
 func (d *defaultCommandBus) Dispatch(c Command) {
-	go d.handleCommand(c)
+	if err := d.TryDispatch(c); err != nil {
+		panic(err)
+	}
+}
+
+// TryDispatch executes the given command asynchronously in a new goroutine.
+// The handler lookup happens before returning, so a missing registration is reported as ErrNoHandler.
+// Errors returned by the handlers themselves are not reported back to the caller.
+func (d *defaultCommandBus) TryDispatch(c Command) error {
+	return d.DispatchContext(context.Background(), c)
+}
+
+// DispatchContext executes the given command asynchronously on the worker pool of the bus.
+// When the pool queue is full its backpressure policy applies: the call blocks, the command is dropped,
+// or ErrQueueFull is returned.
+// The handlers run with a context detached from the cancellation of ctx but carrying its values.
+// A panic inside a handler is recovered and does not crash the process.
+func (d *defaultCommandBus) DispatchContext(ctx context.Context, c Command) error {
+	env := wrapCommand(ctx, c)
+	if err := d.checkHandlers(env.Command); err != nil {
+		return err
+	}
+	err := d.submit(ctx, env, nil)
+	if errors.Is(err, ErrDropped) {
+		return nil
+	}
+	return err
+}
+
+// DispatchAsync executes the given command asynchronously on the worker pool of the bus and returns its Future.
+// Commands rejected or dropped by the pool resolve the Future with ErrQueueFull or ErrDropped.
+// The handlers run with a context detached from the cancellation of ctx but carrying its values.
+// A panic inside a handler is recovered and delivered as a *PanicError.
+func (d *defaultCommandBus) DispatchAsync(ctx context.Context, c Command) *Future {
+	env := wrapCommand(ctx, c)
+	if err := d.checkHandlers(env.Command); err != nil {
+		return resolvedFuture(env.Command, err)
+	}
+	f := newFuture()
+	if err := d.submit(ctx, env, f); err != nil {
+		return resolvedFuture(env.Command, err)
+	}
+	return f
+}
+
+// submit queues the command on the worker pool of the bus.
+// The submission itself honours ctx, the execution runs with a context detached from its cancellation.
+// The outcome is delivered to f, or to the error hook if f is nil and the command failed.
+// If the command is abandoned during shutdown its future resolves with ErrClosed.
+func (d *defaultCommandBus) submit(ctx context.Context, env CommandEnvelope, f *Future) error {
+	detached := context.WithoutCancel(ctx)
+	run := func() {
+		d.runAsync(detached, env, f)
+	}
+	abandon := func() {
+		if f != nil {
+			f.resolve(CommandOutcome{Command: env.Command, Err: ErrClosed, StartedAt: time.Now()})
+		}
+	}
+	registry := d.registry.Load()
+	return d.work.submit(ctx, registry.pool, registry.limiter(env.Command), run, abandon)
+}
+
+// Shutdown stops accepting asynchronous commands and waits for the accepted ones to finish.
+// Synchronous execution keeps working, so commands still running can execute other commands.
+// If ctx ends first, queued commands are abandoned and a *ShutdownError is returned.
+func (d *defaultCommandBus) Shutdown(ctx context.Context) error {
+	return d.work.shutdown(ctx)
+}
+
+// Close shuts the bus down and waits for all accepted asynchronous commands to finish.
+func (d *defaultCommandBus) Close() error {
+	return d.Shutdown(context.Background())
+}
+
+// checkHandlers verifies that handlers are registered for the command,
+// so asynchronous dispatches can report a missing registration before returning.
+func (d *defaultCommandBus) checkHandlers(c Command) error {
+	t, err := messageType("command", c)
+	if err != nil {
+		return err
+	}
+	if len(d.registry.Load().handlers[t]) == 0 {
+		return noHandlerError("command", typeName(t))
+	}
+	return nil
+}
+
+// runAsync executes the command and resolves the future with its outcome.
+// Without a future, a failure is passed to the error hook instead, as no caller can observe it.
+func (d *defaultCommandBus) runAsync(ctx context.Context, env CommandEnvelope, f *Future) {
+	started := time.Now()
+	events, err := d.handleCommand(ctx, env)
+	if f == nil {
+		if err != nil {
+			d.reportError(ctx, err)
+		}
+		return
+	}
+	f.resolve(CommandOutcome{
+		Command:   env.Command,
+		Events:    events,
+		Err:       err,
+		StartedAt: started,
+		Duration:  time.Since(started),
+	})
+}
+
+// reportError passes the failure of a fire-and-forget command to the error hook, or logs it without a hook.
+func (d *defaultCommandBus) reportError(ctx context.Context, err error) {
+	if hook := d.registry.Load().errorHook; hook != nil {
+		hook(ctx, err)
+		return
+	}
+	logError(ctx, err)
 }
 
 // Execute executes the given command synchronously.
 // It finds the registered handler, executes the command, and dispatches any resulting events.
 // Use this when you need to ensure the command has finished executing.
 func (d *defaultCommandBus) Execute(c Command) {
-	d.handleCommand(c)
+	if err := d.TryExecute(c); err != nil {
+		panic(err)
+	}
+}
+
+// TryExecute executes the given command synchronously and returns the first error encountered.
+// Handlers registered after a failing one are not executed.
+func (d *defaultCommandBus) TryExecute(c Command) error {
+	return d.ExecuteContext(context.Background(), c)
+}
+
+// ExecuteContext executes the given command synchronously within the given context.
+// The context is passed to context-aware handlers and to the event bus when dispatching events.
+// Commands of a type with a concurrency limit wait for a slot first.
+func (d *defaultCommandBus) ExecuteContext(ctx context.Context, c Command) error {
+	env := wrapCommand(ctx, c)
+	if limiter := d.registry.Load().limiter(env.Command); limiter != nil {
+		if err := limiter.acquire(ctx); err != nil {
+			return err
+		}
+		defer limiter.release()
+	}
+	_, err := d.handleCommand(ctx, env)
+	return err
 }
 
 // Register stores a command handler for the given command type.
-// It uses reflection to extract the type name from the command instance.
+// It uses reflection to extract the type from the command instance.
 // Multiple handlers can be registered for the same command type.
+// Shared handlers that do not implement EventClearer keep all events they collected, as the bus cannot clear them.
 func (d *defaultCommandBus) Register(c Command, ch CommandHandler) {
-	typeName := reflect.TypeOf(c).Name()
-	d.handlers[typeName] = append(d.handlers[typeName], ch)
+	if err := d.TryRegister(c, ch); err != nil {
+		panic(err)
+	}
+}
+
+// TryRegister stores a command handler for the given command type.
+// Pointer commands are registered under the type they point to. The handler receives commands in the form
+// it was registered with, so a handler registered with a pointer can assert the pointer type.
+// Returns ErrInvalidType for nil commands and commands of anonymous types.
+func (d *defaultCommandBus) TryRegister(c Command, ch CommandHandler) error {
+	t, err := messageType("command", c)
+	if err != nil {
+		return err
+	}
+	d.update(func(r *commandRegistry) {
+		r.handlers[t] = appendCopy(r.handlers[t], &commandRegistration{handler: ch, pointer: isPointer(c)})
+	})
+	return nil
+}
+
+// Unregister removes all handlers for the given command type.
+// Middleware added with UseFor for the command type is kept.
+func (d *defaultCommandBus) Unregister(c Command) {
+	t, err := messageType("command", c)
+	if err != nil {
+		return
+	}
+	d.update(func(r *commandRegistry) {
+		delete(r.handlers, t)
+	})
+}
+
+// SetErrorHook sets the hook that receives failures of commands dispatched with Dispatch, TryDispatch
+// or DispatchContext, including recovered panics. Without a hook these failures are written to the standard logger.
+// Failures of DispatchAsync are delivered through the Future and those of Execute are returned to the caller.
+func (d *defaultCommandBus) SetErrorHook(hook ErrorHook) {
+	d.update(func(r *commandRegistry) {
+		r.errorHook = hook
+	})
+}
+
+// SetWorkerPool replaces the worker pool that executes asynchronously dispatched commands.
+// The pool can be shared with other buses to bound the total number of goroutines.
+func (d *defaultCommandBus) SetWorkerPool(pool *WorkerPool) {
+	d.update(func(r *commandRegistry) {
+		r.pool = pool
+	})
+}
+
+// SetConcurrencyLimit bounds the number of commands of the given type that execute at the same time,
+// whether they were executed synchronously or dispatched asynchronously.
+// Synchronous executions beyond the limit wait for a slot or until their context is done. Asynchronous ones wait
+// without occupying a worker of the pool, so commands of other types sharing the pool keep making progress.
+// A limit of zero or less removes the bound.
+// Panics if the command is nil or not of a named type.
+func (d *defaultCommandBus) SetConcurrencyLimit(c Command, limit int) {
+	t, err := messageType("command", c)
+	if err != nil {
+		panic(err)
+	}
+	d.update(func(r *commandRegistry) {
+		if limit <= 0 {
+			delete(r.limits, t)
+			return
+		}
+		r.limits[t] = newConcurrencyLimiter(limit)
+	})
+}
+
+// Use adds middleware that wraps the handling of every command.
+// Global middleware runs before any per-type middleware added with UseFor,
+// and middleware added first is the outermost one.
+func (d *defaultCommandBus) Use(mw ...CommandMiddleware) {
+	d.update(func(r *commandRegistry) {
+		r.middleware = appendCopy(r.middleware, mw...)
+	})
+}
+
+// UseFor adds middleware that only wraps the handling of commands of the given type.
+// It runs after the global middleware, in the order it was added.
+// Panics if the command is nil or not of a named type.
+func (d *defaultCommandBus) UseFor(c Command, mw ...CommandMiddleware) {
+	t, err := messageType("command", c)
+	if err != nil {
+		panic(err)
+	}
+	d.update(func(r *commandRegistry) {
+		r.typeMiddleware[t] = appendCopy(r.typeMiddleware[t], mw...)
+	})
+}
+
+// update applies the given change to a clone of the registry and publishes the clone.
+func (d *defaultCommandBus) update(change func(r *commandRegistry)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	r := d.registry.Load().clone()
+	change(r)
+	d.registry.Store(r)
 }
 
 // handleCommand is the internal method that processes commands.
-// It looks up the handlers, executes the command, collects events, and dispatches them.
-// Panics if no handlers are registered for the command type.
-func (d *defaultCommandBus) handleCommand(c Command) {
-	typeName := reflect.TypeOf(c).Name()
-	handlers := d.handlers[typeName]
+// It looks up the handlers and runs them through the middleware pipeline.
+// Returns the events that were dispatched, and ErrNoHandler if no handlers are registered for the command type.
+// Panics in middleware or handlers are recovered and returned as a *PanicError.
+// Middleware and handlers receive the envelope of the command in their context,
+// the dispatched events share its correlation ID and carry its headers, issuer and timestamp as metadata.
+func (d *defaultCommandBus) handleCommand(ctx context.Context, env CommandEnvelope) (dispatched []Event, err error) {
+	defer recoverPanic(&err)
+	c := env.Command
+	t, err := messageType("command", c)
+	if err != nil {
+		return nil, err
+	}
+	registry := d.registry.Load()
+	handlers := registry.handlers[t]
 	if len(handlers) == 0 {
-		panic("no handlers registered for command type: " + typeName)
+		return nil, noHandlerError("command", typeName(t))
+	}
+	ctx = withCommandEnvelope(ctx, env)
+	next := func(ctx context.Context, c Command) error {
+		if registry.unitOfWork {
+			return d.runUnitOfWork(ctx, registry, t, handlers, c, env.eventMetadata(), &dispatched)
+		}
+		return d.runHandlers(ctx, registry, t, handlers, c, env.eventMetadata(), &dispatched)
+	}
+	err = chainCommandMiddleware(next, registry.middleware, registry.typeMiddleware[t])(ctx, c)
+	return dispatched, err
+}
+
+// runHandlers executes the command on each handler and dispatches the collected events with the given metadata,
+// recording every dispatched event in dispatched. With an event store the events are appended to it
+// first, with an outbox they are saved to it instead of being dispatched.
+// It stops at the first handler that fails, when the context is done or the events cannot be persisted. Failing event subscribers
+// do not stop the command: all events are still dispatched and the dispatch errors are returned together at the end.
+func (d *defaultCommandBus) runHandlers(ctx context.Context, registry *commandRegistry, t reflect.Type, handlers []*commandRegistration, c Command, metadata map[string]string, dispatched *[]Event) error {
+	var dispatchErrs []error
+	for _, reg := range handlers {
+		if err := ctx.Err(); err != nil {
+			return errors.Join(append(dispatchErrs, err)...)
+		}
+		events, err := reg.execute(ctx, c)
+		if err != nil {
+			return errors.Join(append(dispatchErrs, handlerError("command", typeName(t), err))...)
+		}
+		envelopes := newEnvelopes(ctx, events, metadata)
+		if err := registry.persist(ctx, envelopes); err != nil {
+			return errors.Join(append(dispatchErrs, err)...)
+		}
+		if registry.outbox != nil {
+			*dispatched = append(*dispatched, events...)
+			continue
+		}
+		dispatchErrs = append(dispatchErrs, d.publish(ctx, envelopes, dispatched)...)
+	}
+	return errors.Join(dispatchErrs...)
+}
+
+// newEnvelopes wraps the events collected from a handler in envelopes carrying a copy of the given metadata.
+func newEnvelopes(ctx context.Context, events []Event, metadata map[string]string) []Envelope {
+	envelopes := make([]Envelope, len(events))
+	for i, e := range events {
+		envelopes[i] = Envelope{Event: e, Metadata: maps.Clone(metadata)}.complete(ctx)
+	}
+	return envelopes
+}
+
+// discard drops envelopes saved by persist from an outbox implementing OutboxDiscarder.
+// Other outboxes are expected to take part in the transaction, so nothing is left to discard.
+func (r *commandRegistry) discard(ctx context.Context, envelopes []Envelope) error {
+	discarder, ok := r.outbox.(OutboxDiscarder)
+	if !ok || len(envelopes) == 0 {
+		return nil
+	}
+	ids := make([]string, len(envelopes))
+	for i, env := range envelopes {
+		ids[i] = env.ID
+	}
+	if err := discarder.Discard(ctx, ids...); err != nil {
+		return fmt.Errorf("gocqrs: discard events from outbox: %w", err)
 	}
-	for _, ch := range handlers {
-		ch = ch.Handle(c)
-		events := ch.CollectEvents()
-		for _, e := range events {
-			d.EventBus.Dispatch(e)
+	return nil
+}
+
+// limiter returns the limiter bounding the concurrent executions of the command's type, nil if there is none.
+func (r *commandRegistry) limiter(c Command) *concurrencyLimiter {
+	t, err := messageType("command", c)
+	if err != nil {
+		return nil
+	}
+	return r.limits[t]
+}
+
+// persist saves the envelopes to the outbox and appends them to the event store, if the bus has them.
+// The outbox is written first, so stored events are never left unrelayed. If the append fails, the envelopes
+// are dropped again from an outbox implementing OutboxDiscarder. The envelopes are updated with the stream versions
+// assigned by the event store, the outbox keeps the versions set by the events.
+func (r *commandRegistry) persist(ctx context.Context, envelopes []Envelope) error {
+	if err := r.save(ctx, envelopes); err != nil {
+		return err
+	}
+	if err := r.store(ctx, envelopes); err != nil {
+		return errors.Join(err, r.discard(context.WithoutCancel(ctx), envelopes))
+	}
+	return nil
+}
+
+// save stores the envelopes in the outbox, if the bus has one.
+func (r *commandRegistry) save(ctx context.Context, envelopes []Envelope) error {
+	if r.outbox == nil || len(envelopes) == 0 {
+		return nil
+	}
+	if err := r.outbox.Save(ctx, envelopes); err != nil {
+		return fmt.Errorf("gocqrs: save events to outbox: %w", err)
+	}
+	return nil
+}
+
+// store appends the envelopes to the event store, if the bus has one,
+// and updates them with the stream versions it assigned.
+func (r *commandRegistry) store(ctx context.Context, envelopes []Envelope) error {
+	if r.eventStore == nil || len(envelopes) == 0 {
+		return nil
+	}
+	return appendToStore(ctx, r.eventStore, envelopes)
+}
+
+// publish dispatches the envelopes to the event bus, recording each of their events in dispatched.
+// All events are dispatched even if some fail, the dispatch errors are returned.
+func (d *defaultCommandBus) publish(ctx context.Context, envelopes []Envelope, dispatched *[]Event) []error {
+	var errs []error
+	for _, env := range envelopes {
+		*dispatched = append(*dispatched, env.Event)
+		if err := d.EventBus.DispatchEnvelope(ctx, env); err != nil {
+			errs = append(errs, err)
 		}
 	}
+	return errs
+}
+
+// commandRegistration is a handler registered for a command type.
+type commandRegistration struct {
+	// handler is the registered handler, possibly shared by all executions
+	handler CommandHandler
+	// pointer is set if the handler was registered with a pointer command, commands are passed in that form
+	pointer bool
+	// mu serializes executions of a shared handler instance
+	mu sync.Mutex
+}
+
+// execute runs the command on the registered handler and returns only the events of this execution.
+// A panicking handler is recovered and reported as a *PanicError.
+// Shared handler instances are executed one at a time. Their events are cleared afterwards when they
+// implement EventClearer, otherwise the events collected by previous executions are skipped.
+func (r *commandRegistration) execute(ctx context.Context, c Command) (_ []Event, err error) {
+	defer recoverPanic(&err)
+	if c, err = messageForm("command", c, r.pointer); err != nil {
+		return nil, err
+	}
+	if _, ok := r.handler.(isolatedCommandHandler); ok {
+		ch, err := invokeCommandHandler(ctx, r.handler, c)
+		if err != nil {
+			return nil, err
+		}
+		return ch.CollectEvents(), nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	clearer, clears := r.handler.(EventClearer)
+	if clears {
+		defer clearer.ClearEvents()
+	}
+
+	before := len(r.handler.CollectEvents())
+	ch, err := invokeCommandHandler(ctx, r.handler, c)
+	if err != nil {
+		return nil, err
+	}
+	events := ch.CollectEvents()
+	if !clears && sameHandler(ch, r.handler) && before <= len(events) {
+		events = events[before:]
+	}
+	return slices.Clone(events), nil
+}
+
+// sameHandler reports whether both handlers are the same instance.
+// Pointers are compared by address, other values only when their type is comparable.
+func sameHandler(a, b CommandHandler) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if !va.IsValid() || !vb.IsValid() || va.Type() != vb.Type() {
+		return false
+	}
+	if va.Kind() == reflect.Pointer {
+		return va.Pointer() == vb.Pointer()
+	}
+	return va.Comparable() && va.Equal(vb)
+}
+
+// invokeCommandHandler calls the most capable handle method the handler implements.
+// ContextCommandHandler is preferred over FallibleCommandHandler, which is preferred over the plain Handle.
+func invokeCommandHandler(ctx context.Context, ch CommandHandler, c Command) (CommandHandler, error) {
+	switch h := ch.(type) {
+	case ContextCommandHandler:
+		return h.HandleContext(ctx, c)
+	case FallibleCommandHandler:
+		return h.TryHandle(c)
+	default:
+		return ch.Handle(c), nil
+	}
 }
 
 // DefaultCommandBus creates a new instance of the default command bus implementation.
 // Requires an event bus instance for dispatching domain events produced by command handlers.
 // Returns a CommandBus that uses reflection-based handler lookup.
+// Asynchronous commands run on a worker pool created with DefaultWorkerPoolConfig.
 func DefaultCommandBus(eventBus EventBus) *defaultCommandBus {
-	return &defaultCommandBus{
-		EventBus: eventBus,
-		handlers: make(map[string][]CommandHandler),
-	}
-}
\ No newline at end of file
+	d := &defaultCommandBus{EventBus: eventBus}
+	d.registry.Store(&commandRegistry{
+		handlers:       make(map[reflect.Type][]*commandRegistration),
+		typeMiddleware: make(map[reflect.Type][]CommandMiddleware),
+		limits:         make(map[reflect.Type]*concurrencyLimiter),
+		pool:           NewWorkerPool(DefaultWorkerPoolConfig()),
+	})
+	return d
+}
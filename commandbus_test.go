@@ -0,0 +1,353 @@
+package gocqrs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testCommand struct {
+	Name string
+}
+
+type testEvent struct {
+	Name string
+}
+
+func (e testEvent) GetEventType() string {
+	return "TestEvent"
+}
+
+type testCommandHandler struct {
+	events []Event
+}
+
+func (h *testCommandHandler) Handle(c Command) CommandHandler {
+	h.events = append(h.events, testEvent{Name: c.(testCommand).Name})
+	return h
+}
+
+func (h *testCommandHandler) CollectEvents() []Event {
+	return h.events
+}
+
+type failingCommandHandler struct {
+	testCommandHandler
+	err error
+}
+
+func (h *failingCommandHandler) TryHandle(c Command) (CommandHandler, error) {
+	return h, h.err
+}
+
+type contextKey string
+
+type contextCommandHandler struct {
+	testCommandHandler
+	seen chan any
+}
+
+func (h *contextCommandHandler) HandleContext(ctx context.Context, c Command) (CommandHandler, error) {
+	if err := ctx.Err(); err != nil {
+		return h, err
+	}
+	h.seen <- ctx.Value(contextKey("user"))
+	h.events = append(h.events, testEvent{})
+	return h, nil
+}
+
+func TestTryExecuteNoHandler(t *testing.T) {
+	commandBus := DefaultCommandBus(DefaultSyncEventBus())
+
+	err := commandBus.TryExecute(testCommand{})
+	if !errors.Is(err, ErrNoHandler) {
+		t.Errorf("Expected ErrNoHandler, got %v", err)
+	}
+
+	err = commandBus.TryDispatch(testCommand{})
+	if !errors.Is(err, ErrNoHandler) {
+		t.Errorf("Expected ErrNoHandler from TryDispatch, got %v", err)
+	}
+}
+
+func TestTryExecuteHandlerError(t *testing.T) {
+	var received []Event
+	eventBus := DefaultSyncEventBus()
+	eventBus.Register("TestEvent", func(e Event) {
+		received = append(received, e)
+	})
+	commandBus := DefaultCommandBus(eventBus)
+
+	handlerErr := errors.New("boom")
+	commandBus.Register(testCommand{}, &failingCommandHandler{err: handlerErr})
+
+	err := commandBus.TryExecute(testCommand{Name: "test"})
+	if !errors.Is(err, ErrHandlerFailed) {
+		t.Errorf("Expected ErrHandlerFailed, got %v", err)
+	}
+	if !errors.Is(err, handlerErr) {
+		t.Errorf("Expected wrapped handler error, got %v", err)
+	}
+	if len(received) != 0 {
+		t.Errorf("Expected no events from a failed handler, got %d", len(received))
+	}
+}
+
+func TestExecutePanicsWithoutHandler(t *testing.T) {
+	commandBus := DefaultCommandBus(DefaultSyncEventBus())
+
+	defer func() {
+		r := recover()
+		err, ok := r.(error)
+		if !ok || !errors.Is(err, ErrNoHandler) {
+			t.Errorf("Expected panic with ErrNoHandler, got %v", r)
+		}
+	}()
+	commandBus.Execute(testCommand{})
+}
+
+func TestExecuteContextPropagatesValues(t *testing.T) {
+	var received []any
+	eventBus := DefaultSyncEventBus()
+	eventBus.RegisterContext("TestEvent", func(ctx context.Context, e Event) error {
+		received = append(received, ctx.Value(contextKey("user")))
+		return nil
+	})
+	commandBus := DefaultCommandBus(eventBus)
+	handler := &contextCommandHandler{seen: make(chan any, 1)}
+	commandBus.Register(testCommand{}, handler)
+
+	ctx := context.WithValue(context.Background(), contextKey("user"), "alice")
+	if err := commandBus.ExecuteContext(ctx, testCommand{}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if user := <-handler.seen; user != "alice" {
+		t.Errorf("Expected handler to see user 'alice', got %v", user)
+	}
+	if len(received) != 1 || received[0] != "alice" {
+		t.Errorf("Expected event handler to see user 'alice', got %v", received)
+	}
+}
+
+func TestExecuteContextCancelled(t *testing.T) {
+	commandBus := DefaultCommandBus(DefaultSyncEventBus())
+	commandBus.Register(testCommand{}, &contextCommandHandler{seen: make(chan any, 1)})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := commandBus.ExecuteContext(ctx, testCommand{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestDispatchContextDetachesCancellation(t *testing.T) {
+	commandBus := DefaultCommandBus(DefaultSyncEventBus())
+	handler := &contextCommandHandler{seen: make(chan any, 1)}
+	commandBus.Register(testCommand{}, handler)
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), contextKey("user"), "bob"))
+	cancel()
+
+	if err := commandBus.DispatchContext(ctx, testCommand{}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	select {
+	case user := <-handler.seen:
+		if user != "bob" {
+			t.Errorf("Expected handler to see user 'bob', got %v", user)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for the dispatched command")
+	}
+}
+
+func TestRegisterKeysByType(t *testing.T) {
+	// A type with the same name as the package level testCommand, as if declared in another package
+	type testCommand struct{}
+
+	var received []string
+	eventBus := DefaultSyncEventBus()
+	Subscribe(eventBus, func(ctx context.Context, e testEvent) error {
+		received = append(received, e.Name)
+		return nil
+	})
+	commandBus := DefaultCommandBus(eventBus)
+	RegisterCommand(commandBus, func(ctx context.Context, c testCommand) ([]Event, error) {
+		return []Event{testEvent{Name: "local"}}, nil
+	})
+
+	if err := commandBus.TryExecute(testCommand{}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := commandBus.TryExecute(gocqrsTestCommand{}); !errors.Is(err, ErrNoHandler) {
+		t.Errorf("Expected ErrNoHandler for the package level command, got %v", err)
+	}
+	if len(received) != 1 || received[0] != "local" {
+		t.Errorf("Expected events [local], got %v", received)
+	}
+}
+
+// gocqrsTestCommand refers to the package level testCommand from scopes where it is shadowed.
+type gocqrsTestCommand = testCommand
+
+func TestRegisterNormalizesPointers(t *testing.T) {
+	var received []Event
+	eventBus := DefaultSyncEventBus()
+	eventBus.Register("TestEvent", func(e Event) {
+		received = append(received, e)
+	})
+	commandBus := DefaultCommandBus(eventBus)
+	RegisterCommand(commandBus, func(ctx context.Context, c *testCommand) ([]Event, error) {
+		return []Event{testEvent{Name: c.Name}}, nil
+	})
+
+	if err := commandBus.TryExecute(testCommand{Name: "value"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := commandBus.TryExecute(&testCommand{Name: "pointer"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(received) != 2 {
+		t.Errorf("Expected 2 events, got %d", len(received))
+	}
+
+	// Plain handlers assert the registered value type, so pointers are dereferenced before they are called
+	handler := &testCommandHandler{}
+	plainBus := DefaultCommandBus(eventBus)
+	plainBus.Register(testCommand{}, handler)
+	if err := plainBus.TryExecute(&testCommand{Name: "pointer"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(handler.events) != 1 || handler.events[0] != (testEvent{Name: "pointer"}) || len(received) != 3 {
+		t.Errorf("Expected the plain handler to receive the command value, got %v", handler.events)
+	}
+	if err := plainBus.TryExecute((*testCommand)(nil)); !errors.Is(err, ErrInvalidType) {
+		t.Errorf("Expected ErrInvalidType for a nil pointer command, got %v", err)
+	}
+
+	// Handlers registered with a pointer receive the sender's pointer, writes to it are visible to the sender
+	pointerBus := DefaultCommandBus(eventBus)
+	pointerBus.Register(&testCommand{}, &pointerCommandHandler{})
+	command := &testCommand{Name: "pointer"}
+	if err := pointerBus.TryExecute(command); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if command.Name != "pointer handled" {
+		t.Errorf("Expected the handler to update the command, got %q", command.Name)
+	}
+	if err := pointerBus.TryExecute(testCommand{Name: "value"}); err != nil {
+		t.Errorf("Expected a value command to reach the pointer handler, got %v", err)
+	}
+}
+
+type pointerCommandHandler struct {
+	events []Event
+}
+
+func (h *pointerCommandHandler) Handle(c Command) CommandHandler {
+	command := c.(*testCommand)
+	command.Name += " handled"
+	h.events = append(h.events, testEvent{Name: command.Name})
+	return h
+}
+
+func (h *pointerCommandHandler) CollectEvents() []Event {
+	return h.events
+}
+
+func TestTryRegisterRejectsInvalidTypes(t *testing.T) {
+	commandBus := DefaultCommandBus(DefaultSyncEventBus())
+
+	if err := commandBus.TryRegister(struct{}{}, &testCommandHandler{}); !errors.Is(err, ErrInvalidType) {
+		t.Errorf("Expected ErrInvalidType for an anonymous command, got %v", err)
+	}
+	if err := commandBus.TryRegister(nil, &testCommandHandler{}); !errors.Is(err, ErrInvalidType) {
+		t.Errorf("Expected ErrInvalidType for a nil command, got %v", err)
+	}
+}
+
+func TestUnregister(t *testing.T) {
+	commandBus := DefaultCommandBus(DefaultSyncEventBus())
+	RegisterCommand(commandBus, func(ctx context.Context, c testCommand) ([]Event, error) {
+		return nil, nil
+	})
+	commandBus.Unregister(testCommand{})
+
+	if err := commandBus.TryExecute(testCommand{}); !errors.Is(err, ErrNoHandler) {
+		t.Errorf("Expected ErrNoHandler after unregistering, got %v", err)
+	}
+}
+
+type clearingCommandHandler struct {
+	testCommandHandler
+}
+
+func (h *clearingCommandHandler) ClearEvents() {
+	h.events = nil
+}
+
+func TestSharedHandlerDoesNotRedispatchEvents(t *testing.T) {
+	handlers := map[string]CommandHandler{
+		"accumulating": &testCommandHandler{},
+		"clearing":     &clearingCommandHandler{},
+	}
+	for name, handler := range handlers {
+		var received []string
+		eventBus := DefaultSyncEventBus()
+		Subscribe(eventBus, func(ctx context.Context, e testEvent) error {
+			received = append(received, e.Name)
+			return nil
+		})
+		commandBus := DefaultCommandBus(eventBus)
+		commandBus.Register(testCommand{}, handler)
+
+		commandBus.Execute(testCommand{Name: "first"})
+		commandBus.Execute(testCommand{Name: "second"})
+
+		if len(received) != 2 || received[0] != "first" || received[1] != "second" {
+			t.Errorf("%s: expected events [first second], got %v", name, received)
+		}
+	}
+}
+
+func TestCommandHandlerFactory(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	eventBus := DefaultSyncEventBus()
+	Subscribe(eventBus, func(ctx context.Context, e testEvent) error {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, e.Name)
+		return nil
+	})
+	commandBus := DefaultCommandBus(eventBus)
+
+	var created atomic.Int64
+	commandBus.Register(testCommand{}, CommandHandlerFactory(func() CommandHandler {
+		created.Add(1)
+		return &testCommandHandler{}
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			commandBus.Execute(testCommand{Name: "concurrent"})
+		}()
+	}
+	wg.Wait()
+
+	if created.Load() != 10 {
+		t.Errorf("Expected 10 handlers to be created, got %d", created.Load())
+	}
+	if len(received) != 10 {
+		t.Errorf("Expected 10 events, got %d", len(received))
+	}
+}
@@ -0,0 +1,112 @@
+package gocqrs
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// These tests register handlers while messages are being dispatched.
+// They are meant to be run with the race detector: go test -race ./...
+
+const concurrencyWorkers = 8
+
+func TestCommandBusConcurrentRegisterAndExecute(t *testing.T) {
+	var received atomic.Int64
+	eventBus := DefaultSyncEventBus()
+	eventBus.Register("TestEvent", func(e Event) {
+		received.Add(1)
+	})
+	commandBus := DefaultCommandBus(eventBus)
+	RegisterCommand(commandBus, func(ctx context.Context, c testCommand) ([]Event, error) {
+		return []Event{testEvent{Name: c.Name}}, nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrencyWorkers; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if err := commandBus.TryExecute(testCommand{Name: "concurrent"}); err != nil {
+					t.Errorf("Expected no error, got %v", err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				commandBus.Use(func(next CommandHandlerFunc) CommandHandlerFunc { return next })
+				eventBus.Register("OtherEvent", func(e Event) {})
+			}
+		}()
+	}
+	wg.Wait()
+
+	if received.Load() != concurrencyWorkers*100 {
+		t.Errorf("Expected %d events, got %d", concurrencyWorkers*100, received.Load())
+	}
+}
+
+func TestCommandBusConcurrentRegisterAndDispatch(t *testing.T) {
+	var wg sync.WaitGroup
+	eventBus := DefaultAsyncEventBus()
+	eventBus.Register("TestEvent", func(e Event) {
+		wg.Done()
+	})
+	commandBus := DefaultCommandBus(eventBus)
+	RegisterCommand(commandBus, func(ctx context.Context, c testCommand) ([]Event, error) {
+		return []Event{testEvent{}}, nil
+	})
+
+	var registrations sync.WaitGroup
+	for i := 0; i < concurrencyWorkers; i++ {
+		registrations.Add(1)
+		go func() {
+			defer registrations.Done()
+			for j := 0; j < 10; j++ {
+				eventBus.Use(func(sub Subscriber, next ContextEventHandler) ContextEventHandler { return next })
+			}
+		}()
+		for j := 0; j < 10; j++ {
+			wg.Add(1)
+			commandBus.Dispatch(testCommand{})
+		}
+	}
+	registrations.Wait()
+	wg.Wait()
+}
+
+func TestQueryBusConcurrentRegisterAndAsk(t *testing.T) {
+	queryBus := DefaultQueryBus()
+	RegisterQuery(queryBus, func(ctx context.Context, q testQuery) (int, error) {
+		return q.ID, nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrencyWorkers; i++ {
+		wg.Add(2)
+		go func(id int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				result, err := Ask[int](context.Background(), queryBus, testQuery{ID: id})
+				if err != nil || result != id {
+					t.Errorf("Expected %d, got %d (%v)", id, result, err)
+					return
+				}
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				queryBus.Register(testQuery{}, queryHandlerFunc[testQuery, int](func(ctx context.Context, q testQuery) (int, error) {
+					return q.ID, nil
+				}))
+				queryBus.Use(func(next QueryHandlerFunc) QueryHandlerFunc { return next })
+			}
+		}()
+	}
+	wg.Wait()
+}
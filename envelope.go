@@ -0,0 +1,237 @@
+package gocqrs
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"maps"
+	"time"
+)
+
+// AggregateEvent is an optional interface an Event can implement to identify the aggregate it belongs to.
+// The event bus copies the aggregate ID and version into the Envelope of the event.
+type AggregateEvent interface {
+	Event
+
+	// GetAggregateID returns the ID of the aggregate the event belongs to.
+	GetAggregateID() string
+
+	// GetAggregateVersion returns the version of the aggregate after the event was applied.
+	GetAggregateVersion() int64
+}
+
+// Envelope wraps a dispatched event with the metadata the event bus maintains for it.
+// The bus creates an envelope for every dispatched event and makes it available to subscribers
+// through EnvelopeFromContext, or directly to handlers registered with RegisterEnvelope.
+// Envelopes are shared by all subscribers of an event and must not be modified.
+type Envelope struct {
+	// ID uniquely identifies the event
+	ID string
+	// Event is the wrapped domain event
+	Event Event
+	// Timestamp is the time the event was dispatched, in UTC
+	Timestamp time.Time
+	// AggregateID identifies the aggregate the event belongs to, empty if the event does not implement AggregateEvent
+	AggregateID string
+	// Version is the version of the aggregate after the event, zero if the event does not implement AggregateEvent
+	Version int64
+	// SchemaVersion is the version of the event's payload layout, 1 unless the event implements VersionedEvent.
+	// Events read from a store have been upcast to the current schema version of their type.
+	SchemaVersion int
+	// CorrelationID is shared by all messages resulting from the same originating request
+	CorrelationID string
+	// CausationID is the ID of the message that caused the event, empty if it was dispatched directly
+	CausationID string
+	// Metadata holds additional key-value pairs describing the event
+	Metadata map[string]string
+}
+
+// EnvelopeHandler defines a function type for handling events together with their envelope.
+// It is registered with EventBus.RegisterEnvelope.
+type EnvelopeHandler func(ctx context.Context, env Envelope) error
+
+// complete fills the fields of the envelope that are not set yet.
+// IDs and timestamps are generated, correlation and causation are taken from the context.
+// Without a correlation ID in the context the event starts a new correlation with its own ID.
+func (env Envelope) complete(ctx context.Context) Envelope {
+	if env.ID == "" {
+		env.ID = newID()
+	}
+	if env.Timestamp.IsZero() {
+		env.Timestamp = time.Now().UTC()
+	}
+	if ae, ok := env.Event.(AggregateEvent); ok && env.AggregateID == "" {
+		env.AggregateID = ae.GetAggregateID()
+		env.Version = ae.GetAggregateVersion()
+	}
+	if env.SchemaVersion == 0 {
+		env.SchemaVersion = schemaVersion(env.Event)
+	}
+	if env.CorrelationID == "" {
+		env.CorrelationID = CorrelationIDFromContext(ctx)
+	}
+	if env.CorrelationID == "" {
+		env.CorrelationID = env.ID
+	}
+	if env.CausationID == "" {
+		env.CausationID = causationIDFromContext(ctx)
+	}
+	return env
+}
+
+// CommandEnvelope wraps a command with metadata about who issued it, when and in which context.
+// A CommandEnvelope, or a pointer to one, can be passed to every execute and dispatch method of a CommandBus.
+// The bus routes and hands the wrapped command to the handlers and makes the envelope available to middleware
+// and handlers through CommandEnvelopeFromContext. Commands passed without an envelope are wrapped automatically.
+type CommandEnvelope struct {
+	// ID uniquely identifies the command, generated if empty
+	ID string
+	// Command is the wrapped command
+	Command Command
+	// Issuer identifies the user or system that issued the command
+	Issuer string
+	// Timestamp is the time the command was issued, set to the time it was accepted by the bus if zero
+	Timestamp time.Time
+	// CorrelationID is shared by all messages resulting from the same originating request,
+	// taken from the context or the command ID if empty
+	CorrelationID string
+	// CausationID is the ID of the message that caused the command, taken from the context if empty
+	CausationID string
+	// Headers holds custom key-value pairs such as a tenant or request ID.
+	// They are copied into the metadata of the events collected from the command's handlers,
+	// together with the issuer and timestamp under MetadataIssuer and MetadataCommandTimestamp.
+	Headers map[string]string
+}
+
+// Reserved metadata keys under which the command bus copies the envelope of a command into the metadata
+// of the events collected from its handlers. They take precedence over headers with the same key.
+const (
+	// MetadataIssuer holds the issuer of the command, it is omitted if the command has none
+	MetadataIssuer = "gocqrs.issuer"
+	// MetadataCommandTimestamp holds the time the command was issued, in RFC 3339 format with nanoseconds
+	MetadataCommandTimestamp = "gocqrs.command_timestamp"
+)
+
+// wrapCommand returns the envelope of the given command, wrapping it if it is not an envelope already.
+// Missing fields of the envelope are filled in like for events.
+func wrapCommand(ctx context.Context, c Command) CommandEnvelope {
+	switch env := c.(type) {
+	case CommandEnvelope:
+		return env.complete(ctx)
+	case *CommandEnvelope:
+		if env != nil {
+			return env.complete(ctx)
+		}
+	}
+	return CommandEnvelope{Command: c}.complete(ctx)
+}
+
+// eventMetadata returns the metadata of the events collected from the command's handlers:
+// its headers plus its issuer and timestamp under the reserved keys.
+func (env CommandEnvelope) eventMetadata() map[string]string {
+	metadata := maps.Clone(env.Headers)
+	if metadata == nil {
+		metadata = make(map[string]string, 2)
+	}
+	if env.Issuer != "" {
+		metadata[MetadataIssuer] = env.Issuer
+	}
+	metadata[MetadataCommandTimestamp] = env.Timestamp.Format(time.RFC3339Nano)
+	return metadata
+}
+
+// complete fills the fields of the envelope that are not set yet.
+func (env CommandEnvelope) complete(ctx context.Context) CommandEnvelope {
+	if env.ID == "" {
+		env.ID = newID()
+	}
+	if env.Timestamp.IsZero() {
+		env.Timestamp = time.Now().UTC()
+	}
+	if env.CorrelationID == "" {
+		env.CorrelationID = CorrelationIDFromContext(ctx)
+	}
+	if env.CorrelationID == "" {
+		env.CorrelationID = env.ID
+	}
+	if env.CausationID == "" {
+		env.CausationID = causationIDFromContext(ctx)
+	}
+	return env
+}
+
+// correlationIDKey is the context key of the correlation ID.
+type correlationIDKey struct{}
+
+// causationIDKey is the context key of the ID of the message being handled.
+type causationIDKey struct{}
+
+// envelopeKey is the context key of the envelope of the event being handled.
+type envelopeKey struct{}
+
+// commandEnvelopeKey is the context key of the envelope of the command being handled.
+type commandEnvelopeKey struct{}
+
+// WithCorrelationID returns a context carrying the given correlation ID.
+// Commands executed and events dispatched within the context share the correlation ID,
+// so an ID taken from an incoming request can be traced through all resulting messages.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// CorrelationIDFromContext returns the correlation ID carried by the context, or an empty string.
+// Command handlers and event subscribers always receive a context with a correlation ID.
+func CorrelationIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+// EnvelopeFromContext returns the envelope of the event being handled.
+// It is available in the context passed to event subscribers and interceptors.
+func EnvelopeFromContext(ctx context.Context) (Envelope, bool) {
+	env, ok := ctx.Value(envelopeKey{}).(Envelope)
+	return env, ok
+}
+
+// CommandEnvelopeFromContext returns the envelope of the command being handled.
+// It is available in the context passed to command middleware and context-aware command handlers.
+func CommandEnvelopeFromContext(ctx context.Context) (CommandEnvelope, bool) {
+	env, ok := ctx.Value(commandEnvelopeKey{}).(CommandEnvelope)
+	return env, ok
+}
+
+// withCausationID returns a context in which new messages are caused by the message with the given ID.
+func withCausationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, causationIDKey{}, id)
+}
+
+// causationIDFromContext returns the ID of the message being handled, or an empty string.
+func causationIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(causationIDKey{}).(string)
+	return id
+}
+
+// withEnvelope returns the context subscribers of the event receive.
+// Messages sent from within the subscribers share the correlation ID of the event and are caused by it.
+func withEnvelope(ctx context.Context, env Envelope) context.Context {
+	ctx = context.WithValue(ctx, envelopeKey{}, env)
+	ctx = WithCorrelationID(ctx, env.CorrelationID)
+	return withCausationID(ctx, env.ID)
+}
+
+// withCommandEnvelope returns the context middleware and handlers of the command receive.
+// Messages sent while handling the command share its correlation ID and are caused by it.
+func withCommandEnvelope(ctx context.Context, env CommandEnvelope) context.Context {
+	ctx = context.WithValue(ctx, commandEnvelopeKey{}, env)
+	ctx = WithCorrelationID(ctx, env.CorrelationID)
+	return withCausationID(ctx, env.ID)
+}
+
+// newID returns a random version 4 UUID.
+func newID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,203 @@
+package gocqrs
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type openAccount struct {
+	AccountID string
+}
+
+type accountOpened struct {
+	AccountID string
+	Version   int64
+}
+
+func (e accountOpened) GetEventType() string {
+	return "AccountOpened"
+}
+
+func (e accountOpened) GetAggregateID() string {
+	return e.AccountID
+}
+
+func (e accountOpened) GetAggregateVersion() int64 {
+	return e.Version
+}
+
+func TestEnvelopeCorrelation(t *testing.T) {
+	eventBus := DefaultSyncEventBus()
+	commandBus := DefaultCommandBus(eventBus)
+	RegisterCommand(commandBus, func(ctx context.Context, c openAccount) ([]Event, error) {
+		return []Event{accountOpened{AccountID: c.AccountID, Version: 1}}, nil
+	})
+
+	var opened, tested Envelope
+	eventBus.RegisterEnvelope("AccountOpened", func(ctx context.Context, env Envelope) error {
+		opened = env
+		return commandBus.ExecuteContext(ctx, testCommand{Name: "follow-up"})
+	})
+	eventBus.RegisterContext("TestEvent", func(ctx context.Context, e Event) error {
+		tested, _ = EnvelopeFromContext(ctx)
+		return nil
+	})
+	var followUp CommandEnvelope
+	commandBus.Register(testCommand{}, &contextFuncHandler{fn: func(ctx context.Context) {
+		followUp, _ = CommandEnvelopeFromContext(ctx)
+	}})
+
+	ctx := WithCorrelationID(context.Background(), "request-1")
+	if err := commandBus.ExecuteContext(ctx, openAccount{AccountID: "acc-1"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if opened.ID == "" || opened.Timestamp.IsZero() || time.Since(opened.Timestamp) > time.Minute {
+		t.Errorf("Expected generated ID and timestamp, got %+v", opened)
+	}
+	if opened.AggregateID != "acc-1" || opened.Version != 1 {
+		t.Errorf("Expected aggregate acc-1 at version 1, got %q at %d", opened.AggregateID, opened.Version)
+	}
+	if opened.CorrelationID != "request-1" || tested.CorrelationID != "request-1" {
+		t.Errorf("Expected correlation ID request-1, got %q and %q", opened.CorrelationID, tested.CorrelationID)
+	}
+	if followUp.CausationID != opened.ID || tested.CausationID != followUp.ID {
+		t.Errorf("Expected causation chain %q -> %q, got %q -> %q", opened.ID, followUp.ID, followUp.CausationID, tested.CausationID)
+	}
+}
+
+func TestEnvelopeNewCorrelation(t *testing.T) {
+	eventBus := DefaultSyncEventBus()
+
+	var first, second Envelope
+	eventBus.RegisterEnvelope("TestEvent", func(ctx context.Context, env Envelope) error {
+		if first.ID == "" {
+			first = env
+		} else {
+			second = env
+		}
+		return nil
+	})
+	eventBus.Dispatch(testEvent{})
+	eventBus.Dispatch(testEvent{})
+
+	if first.ID == second.ID {
+		t.Errorf("Expected unique event IDs, got %q twice", first.ID)
+	}
+	if first.CorrelationID != first.ID || first.CausationID != "" {
+		t.Errorf("Expected event to start its own correlation, got %+v", first)
+	}
+}
+
+func TestDispatchEnvelope(t *testing.T) {
+	eventBus := DefaultAsyncEventBus()
+
+	received := make(chan Envelope, 1)
+	eventBus.RegisterEnvelope("TestEvent", func(ctx context.Context, env Envelope) error {
+		received <- env
+		return nil
+	})
+
+	timestamp := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	err := eventBus.DispatchEnvelope(context.Background(), Envelope{
+		ID:        "event-1",
+		Event:     testEvent{},
+		Timestamp: timestamp,
+		Metadata:  map[string]string{"tenant": "acme"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	env := <-received
+	if env.ID != "event-1" || !env.Timestamp.Equal(timestamp) || env.Metadata["tenant"] != "acme" {
+		t.Errorf("Expected envelope to be kept, got %+v", env)
+	}
+	if env.CorrelationID != "event-1" {
+		t.Errorf("Expected missing correlation ID to be filled, got %q", env.CorrelationID)
+	}
+}
+
+func TestCommandEnvelope(t *testing.T) {
+	eventBus := DefaultSyncEventBus()
+	commandBus := DefaultCommandBus(eventBus)
+
+	var seen CommandEnvelope
+	commandBus.Use(func(next CommandHandlerFunc) CommandHandlerFunc {
+		return func(ctx context.Context, c Command) error {
+			seen, _ = CommandEnvelopeFromContext(ctx)
+			return next(ctx, c)
+		}
+	})
+	RegisterCommand(commandBus, func(ctx context.Context, c openAccount) ([]Event, error) {
+		return []Event{accountOpened{AccountID: c.AccountID}}, nil
+	})
+	var opened Envelope
+	eventBus.RegisterEnvelope("AccountOpened", func(ctx context.Context, env Envelope) error {
+		opened = env
+		return nil
+	})
+
+	issued := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	err := commandBus.ExecuteContext(context.Background(), &CommandEnvelope{
+		ID:        "command-1",
+		Command:   openAccount{AccountID: "acc-1"},
+		Issuer:    "alice",
+		Timestamp: issued,
+		Headers:   map[string]string{"tenant": "acme"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if seen.ID != "command-1" || seen.Issuer != "alice" || !seen.Timestamp.Equal(issued) {
+		t.Errorf("Expected middleware to see the envelope, got %+v", seen)
+	}
+	if opened.AggregateID != "acc-1" || opened.Metadata["tenant"] != "acme" {
+		t.Errorf("Expected event with command headers, got %+v", opened)
+	}
+	if opened.Metadata[MetadataIssuer] != "alice" || opened.Metadata[MetadataCommandTimestamp] != issued.Format(time.RFC3339Nano) {
+		t.Errorf("Expected event with command issuer and timestamp, got %v", opened.Metadata)
+	}
+	if opened.CorrelationID != "command-1" || opened.CausationID != "command-1" {
+		t.Errorf("Expected event correlated with and caused by command-1, got %q and %q", opened.CorrelationID, opened.CausationID)
+	}
+}
+
+func TestCommandEnvelopeAsync(t *testing.T) {
+	eventBus := DefaultSyncEventBus()
+	eventBus.SetNoSubscriberPolicy(NoSubscriberIgnore)
+	commandBus := DefaultCommandBus(eventBus)
+
+	seen := make(chan CommandEnvelope, 1)
+	commandBus.Register(testCommand{}, &contextFuncHandler{fn: func(ctx context.Context) {
+		env, _ := CommandEnvelopeFromContext(ctx)
+		seen <- env
+	}})
+
+	ctx := WithCorrelationID(context.Background(), "request-1")
+	outcome, err := commandBus.DispatchAsync(ctx, CommandEnvelope{Command: testCommand{Name: "John"}, Issuer: "bob"}).Wait(context.Background())
+	if err != nil || outcome.Err != nil {
+		t.Fatalf("Expected no error, got %v and %v", err, outcome.Err)
+	}
+	if _, ok := outcome.Command.(testCommand); !ok {
+		t.Errorf("Expected outcome of the wrapped command, got %T", outcome.Command)
+	}
+
+	env := <-seen
+	if env.ID == "" || env.Timestamp.IsZero() || env.Issuer != "bob" || env.CorrelationID != "request-1" {
+		t.Errorf("Expected completed envelope, got %+v", env)
+	}
+}
+
+type contextFuncHandler struct {
+	testCommandHandler
+	fn func(ctx context.Context)
+}
+
+func (h *contextFuncHandler) HandleContext(ctx context.Context, c Command) (CommandHandler, error) {
+	h.fn(ctx)
+	h.events = append(h.events, testEvent{})
+	return h, nil
+}
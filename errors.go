@@ -0,0 +1,115 @@
+package gocqrs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+)
+
+// ErrNoHandler is returned when a command, query or event is sent to a bus
+// that has no handler registered for its type.
+// Use errors.Is to check for it, the returned error also names the offending type.
+var ErrNoHandler = errors.New("gocqrs: no handler registered")
+
+// ErrHandlerFailed is returned when a registered handler reports a failure.
+// The returned error wraps both ErrHandlerFailed and the handler's own error,
+// so errors.Is and errors.As work for either of them.
+var ErrHandlerFailed = errors.New("gocqrs: handler failed")
+
+// ErrInvalidType is returned when a command, query or event type cannot be used as a registry key.
+// Handlers are keyed by named types, so nil values and anonymous types are rejected.
+var ErrInvalidType = errors.New("gocqrs: invalid message type")
+
+// ErrTypeMismatch is returned by the typed helpers when a message or result
+// does not have the Go type the handler or caller expected, and by EventSerializer
+// when an event does not have the Go type registered for its event type.
+var ErrTypeMismatch = errors.New("gocqrs: unexpected type")
+
+// PanicError is returned when a handler panics while the bus recovers from it.
+// It keeps the recovered value and the stack trace of the panicking goroutine.
+type PanicError struct {
+	// Value is the value passed to panic
+	Value any
+	// Stack is the stack trace captured when the panic was recovered
+	Stack []byte
+}
+
+// newPanicError creates a PanicError for the recovered value, capturing the current stack.
+// It must be called from the deferred function that recovered the panic.
+func newPanicError(value any) *PanicError {
+	return &PanicError{Value: value, Stack: debug.Stack()}
+}
+
+// Error returns a message describing the panic value.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("gocqrs: handler panicked: %v", e.Value)
+}
+
+// Unwrap returns the panic value if it is an error, so errors.Is and errors.As can inspect it.
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
+}
+
+// recoverPanic converts a panic into a *PanicError stored in err.
+// It must be deferred directly: defer recoverPanic(&err).
+func recoverPanic(err *error) {
+	if r := recover(); r != nil {
+		*err = newPanicError(r)
+	}
+}
+
+// SubscriberError describes a failed invocation of an event subscriber.
+// Errors returned by synchronous event buses and passed to error hooks wrap it,
+// so errors.As can be used to find out which subscriber failed on which event.
+type SubscriberError struct {
+	// Subscriber identifies the handler that failed
+	Subscriber Subscriber
+	// Event is the event the handler failed on
+	Event Event
+	// Err is the error returned by the handler, or a *PanicError if it panicked
+	Err error
+}
+
+// Error returns a message naming the subscriber and its error.
+func (e *SubscriberError) Error() string {
+	return fmt.Sprintf("subscriber %d (%s): %v", e.Subscriber.ID, e.Subscriber.Name, e.Err)
+}
+
+// Unwrap returns the error of the handler.
+func (e *SubscriberError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorHook receives failures that happen while a bus processes messages.
+// It is called for every failing event subscriber, and for asynchronously dispatched commands
+// whose caller does not wait for the outcome. Panics are reported as a *PanicError with stack trace.
+// Hooks of asynchronous work may be called concurrently.
+type ErrorHook func(ctx context.Context, err error)
+
+// logError is the error hook used for asynchronous failures when no hook is set.
+// Without it failures of fire-and-forget work, including recovered panics, would go unnoticed.
+func logError(_ context.Context, err error) {
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		log.Printf("%v\n%s", err, panicErr.Stack)
+		return
+	}
+	log.Print(err)
+}
+
+// noHandlerError builds an ErrNoHandler error for the given kind of message and type name.
+// The kind is one of "command", "query" or "event".
+func noHandlerError(kind, typeName string) error {
+	return fmt.Errorf("%w for %s type: %s", ErrNoHandler, kind, typeName)
+}
+
+// handlerError wraps an error returned by a handler with ErrHandlerFailed.
+// The kind and type name are included in the message to ease debugging.
+func handlerError(kind, typeName string, err error) error {
+	return fmt.Errorf("%w for %s type %s: %w", ErrHandlerFailed, kind, typeName, err)
+}
@@ -1,5 +1,17 @@
 package gocqrs
 
+import (
+	"context"
+	"errors"
+	"log"
+	"maps"
+	"reflect"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
 // Event represents a domain event that has occurred in the system.
 // Events are immutable facts about something that has happened.
 // Examples: UserCreatedEvent, OrderProcessedEvent, PaymentFailedEvent
@@ -15,72 +27,544 @@ type Event interface {
 // They are called synchronously when events are dispatched.
 type EventHandler func(e Event)
 
+// ContextEventHandler defines a function type for handling domain events within a context.
+// The context carries the values of the dispatching request, such as user or trace IDs.
+// A non-nil error is reported to the caller of DispatchContext when the bus runs synchronously.
+type ContextEventHandler func(ctx context.Context, e Event) error
+
+// NoSubscriberPolicy determines what an event bus does with an event that has no subscribers for its type.
+// Catch-all subscribers registered with RegisterAll do not count as subscribers for the policy,
+// they receive every event regardless of it.
+type NoSubscriberPolicy int
+
+const (
+	// NoSubscriberError reports ErrNoHandler: TryDispatch and DispatchContext return it and Dispatch panics.
+	// This is the default policy.
+	NoSubscriberError NoSubscriberPolicy = iota
+	// NoSubscriberIgnore silently accepts events without subscribers.
+	NoSubscriberIgnore
+	// NoSubscriberLog accepts events without subscribers and writes a message to the standard logger.
+	NoSubscriberLog
+	// NoSubscriberDeadLetter routes events without subscribers to the handler set with SetDeadLetterHandler.
+	// Without a dead-letter handler it behaves like NoSubscriberError.
+	NoSubscriberDeadLetter
+	// NoSubscriberPanic panics on events without subscribers, even from TryDispatch and DispatchContext.
+	NoSubscriberPanic
+)
+
+// Subscriber identifies a handler registered on an event bus.
+// It is passed to event interceptors so they can tell subscribers apart in logs, traces and metrics.
+type Subscriber struct {
+	// ID uniquely identifies the registration within its event bus
+	ID uint64
+	// EventType is the event type or pattern the handler was registered for,
+	// empty for catch-all and dead-letter subscribers
+	EventType string
+	// Name is the fully qualified name of the handler function, as reported by the runtime
+	Name string
+}
+
+// Subscription is returned when an event handler is registered and allows removing it again.
+// Long-lived processes with dynamic subscribers should unsubscribe them to avoid leaking handlers.
+type Subscription interface {
+	// Subscriber returns the identity of the registered handler.
+	Subscriber() Subscriber
+
+	// Unsubscribe removes the handler from the event bus.
+	// It is safe to call while events are being dispatched and to call more than once.
+	// The handler is not invoked for events dispatched after Unsubscribe returns,
+	// but invocations that already started are allowed to complete.
+	Unsubscribe()
+}
+
 // EventBus defines the interface for an event bus that handles domain event dispatch.
 // It provides methods to dispatch events to registered handlers and register event handlers.
 type EventBus interface {
 	// Dispatch sends an event to its registered handler.
 	// The event's GetEventType() method is used to find the appropriate handler.
-	// Panics if no handler is registered for the event type.
+	// Under the default no-subscriber policy it panics if no handler is registered for the event type.
 	Dispatch(e Event)
 
+	// TryDispatch sends an event to its registered handlers like Dispatch.
+	// Returns ErrNoHandler instead of panicking if no handler is registered for the event type
+	// and the no-subscriber policy reports missing subscribers.
+	TryDispatch(e Event) error
+
+	// DispatchContext sends an event to its registered handlers like TryDispatch within the given context.
+	// Asynchronous buses hand the handlers a context that keeps the values of ctx but not its cancellation.
+	// The event is wrapped in an Envelope with a new ID, the current time and the correlation ID of ctx.
+	DispatchContext(ctx context.Context, e Event) error
+
+	// DispatchEnvelope sends the event of the given envelope like DispatchContext, keeping its metadata.
+	// It is used to redeliver stored events under their original ID. Missing fields are filled in.
+	DispatchEnvelope(ctx context.Context, env Envelope) error
+
 	// Register associates an event type with its corresponding handler.
 	// The eventType should match the string returned by Event.GetEventType().
 	// Multiple handlers can be registered per event type.
-	Register(eventType string, eh EventHandler)
+	// The returned Subscription removes the handler again.
+	Register(eventType string, eh EventHandler) Subscription
+
+	// RegisterContext associates an event type with a context-aware handler.
+	// It behaves like Register, but the handler receives the dispatch context and may return an error.
+	RegisterContext(eventType string, eh ContextEventHandler) Subscription
+
+	// RegisterEnvelope associates an event type with a handler that receives the event's Envelope.
+	// It behaves like RegisterContext otherwise.
+	RegisterEnvelope(eventType string, eh EnvelopeHandler) Subscription
+
+	// RegisterAll adds a catch-all handler that receives every dispatched event, whatever its type.
+	// Catch-all handlers do not count as subscribers for the no-subscriber policy.
+	RegisterAll(eh ContextEventHandler) Subscription
+
+	// RegisterPattern adds a handler for all event types matching the given pattern.
+	// Event types are split into tokens at dots: "*" matches any single token, a token ending in "*"
+	// matches tokens with that prefix and a final ">" matches one or more remaining tokens.
+	// Pattern subscribers count as subscribers for the no-subscriber policy.
+	// Panics with ErrInvalidPattern if the pattern cannot be parsed.
+	RegisterPattern(pattern string, eh ContextEventHandler) Subscription
+
+	// Shutdown stops accepting events for asynchronous delivery, drains the queued deliveries and waits for
+	// running handlers until ctx is done. Asynchronous dispatches afterwards fail with ErrClosed.
+	// Returns a *ShutdownError describing the abandoned deliveries if ctx ends first.
+	Shutdown(ctx context.Context) error
+
+	// Close shuts the bus down like Shutdown, waiting without a deadline.
+	Close() error
+}
+
+// eventSubscription pairs a registered event handler with the identity of its subscriber.
+// It implements Subscription.
+type eventSubscription struct {
+	// bus is the event bus the handler is registered on
+	bus *defaultEventBus
+	// subscriber identifies the registration
+	subscriber Subscriber
+	// handler is the registered handler, adapted to a ContextEventHandler
+	handler ContextEventHandler
+	// pattern is the parsed pattern of subscriptions registered with RegisterPattern, nil otherwise
+	pattern *eventPattern
+	// removed is set once the subscription is unsubscribed,
+	// so dispatches working on an older registry skip the handler
+	removed atomic.Bool
+}
+
+// Subscriber returns the identity of the registered handler.
+func (s *eventSubscription) Subscriber() Subscriber {
+	return s.subscriber
+}
+
+// Unsubscribe removes the handler from its event bus.
+// Calling it more than once has no effect.
+func (s *eventSubscription) Unsubscribe() {
+	if s.removed.Swap(true) {
+		return
+	}
+	s.bus.update(func(r *eventRegistry) {
+		r.remove(s)
+	})
+}
+
+// invoke calls the handler wrapped with the given interceptors, unless the subscription was removed.
+// Panics in the handler or its interceptors are recovered, failures are returned as a wrapped *SubscriberError.
+func (s *eventSubscription) invoke(ctx context.Context, e Event, interceptors []EventInterceptor) (err error) {
+	if s.removed.Load() {
+		return nil
+	}
+	defer func() {
+		if err != nil {
+			err = handlerError("event", e.GetEventType(), &SubscriberError{Subscriber: s.subscriber, Event: e, Err: err})
+		}
+	}()
+	defer recoverPanic(&err)
+	return chainEventInterceptors(s.subscriber, s.handler, interceptors)(ctx, e)
+}
+
+// eventRegistry holds the subscriptions and interceptors of an event bus.
+// A registry is never modified once published, changes are made on a clone.
+type eventRegistry struct {
+	// handlers maps event type strings to their corresponding subscriptions
+	handlers map[string][]*eventSubscription
+	// interceptors wrap every handler invocation, in registration order
+	interceptors []EventInterceptor
+	// pool executes the handlers of asynchronous buses
+	pool *WorkerPool
+	// errorHook receives failing handler invocations, nil to only log asynchronous failures
+	errorHook ErrorHook
+	// catchAll holds the subscriptions that receive every event
+	catchAll []*eventSubscription
+	// noSubscriberPolicy determines how events without subscribers are treated
+	noSubscriberPolicy NoSubscriberPolicy
+	// deadLetter receives events without subscribers under NoSubscriberDeadLetter
+	deadLetter *eventSubscription
+	// patterns holds the subscriptions registered with RegisterPattern, in registration order
+	patterns []*eventSubscription
+	// matches caches the subscriptions of each dispatched event type when patterns are registered.
+	// The registry never changes, so entries stay valid for its lifetime.
+	matches sync.Map
+}
+
+// clone returns a copy of the registry that can be modified without affecting readers of the original.
+// Slices are shared, so they must only be extended with appendCopy.
+func (r *eventRegistry) clone() *eventRegistry {
+	return &eventRegistry{
+		handlers:     maps.Clone(r.handlers),
+		interceptors: r.interceptors,
+		pool:         r.pool,
+		errorHook:    r.errorHook,
+		catchAll:     r.catchAll,
+		patterns:     r.patterns,
+
+		noSubscriberPolicy: r.noSubscriberPolicy,
+		deadLetter:         r.deadLetter,
+	}
+}
+
+// remove deletes the subscription from the registry, wherever it was registered.
+func (r *eventRegistry) remove(s *eventSubscription) {
+	isSubscription := func(other *eventSubscription) bool {
+		return other == s
+	}
+	if s.pattern != nil {
+		r.patterns = slices.DeleteFunc(slices.Clone(r.patterns), isSubscription)
+	} else if s.subscriber.EventType != "" {
+		remaining := slices.DeleteFunc(slices.Clone(r.handlers[s.subscriber.EventType]), isSubscription)
+		if len(remaining) == 0 {
+			delete(r.handlers, s.subscriber.EventType)
+		} else {
+			r.handlers[s.subscriber.EventType] = remaining
+		}
+	}
+	r.catchAll = slices.DeleteFunc(slices.Clone(r.catchAll), isSubscription)
+	if r.deadLetter == s {
+		r.deadLetter = nil
+	}
+}
+
+// targets returns the subscriptions that should receive the event, applying the no-subscriber policy.
+// The returned error reports ErrNoHandler when the policy asks for it.
+func (r *eventRegistry) targets(e Event) ([]*eventSubscription, error) {
+	subscriptions := r.subscriptions(e.GetEventType())
+	var err error
+	if len(subscriptions) == 0 {
+		switch r.noSubscriberPolicy {
+		case NoSubscriberIgnore:
+		case NoSubscriberLog:
+			log.Printf("gocqrs: no subscribers for event type: %s", e.GetEventType())
+		case NoSubscriberDeadLetter:
+			if r.deadLetter != nil {
+				subscriptions = []*eventSubscription{r.deadLetter}
+			} else {
+				err = noHandlerError("event", e.GetEventType())
+			}
+		case NoSubscriberPanic:
+			panic(noHandlerError("event", e.GetEventType()))
+		default:
+			err = noHandlerError("event", e.GetEventType())
+		}
+	}
+	if len(r.catchAll) > 0 {
+		subscriptions = append(slices.Clip(subscriptions), r.catchAll...)
+	}
+	return subscriptions, err
+}
+
+// subscriptions returns the exact and pattern subscriptions of the event type.
+// Without pattern subscriptions it is a single map lookup, otherwise the matches are computed once per event type.
+func (r *eventRegistry) subscriptions(eventType string) []*eventSubscription {
+	if len(r.patterns) == 0 {
+		return r.handlers[eventType]
+	}
+	if cached, ok := r.matches.Load(eventType); ok {
+		return cached.([]*eventSubscription)
+	}
+	subscriptions := slices.Clip(r.handlers[eventType])
+	for _, sub := range r.patterns {
+		if sub.pattern.match(eventType) {
+			subscriptions = append(subscriptions, sub)
+		}
+	}
+	r.matches.Store(eventType, subscriptions)
+	return subscriptions
 }
 
 // defaultEventBus is the default implementation of EventBus.
 // It uses a simple map to route events to their handlers based on event type.
+// It is safe for concurrent registration and dispatch.
 type defaultEventBus struct {
-	// handlers maps event type strings to their corresponding handlers
-	handlers map[string][]EventHandler
+	// mu serializes changes to the registry
+	mu sync.Mutex
+	// registry holds the current subscriptions and interceptors and is replaced as a whole on every change
+	registry atomic.Pointer[eventRegistry]
+	// lastID is the ID given to the most recent subscription, guarded by mu
+	lastID uint64
+	// work tracks asynchronous handler invocations for shutdown
+	work lifecycle
 	// async determines whether event handlers should be executed concurrently using goroutines
 	async bool
 }
 
 // Dispatch sends the given event to its registered handlers.
 // Uses the event's GetEventType() method to look up the handlers.
-// Panics if no handlers are registered for the event type.
+// Panics if no handlers are registered for the event type and the no-subscriber policy reports it.
 func (d *defaultEventBus) Dispatch(e Event) {
-	handlers := d.handlers[e.GetEventType()]
-	if len(handlers) == 0 {
-		panic("no handlers registered for event type: " + e.GetEventType())
+	if err := d.TryDispatch(e); err != nil {
+		panic(err)
 	}
+}
+
+// TryDispatch sends the given event to its registered handlers.
+// Returns ErrNoHandler if no handlers are registered for the event type and the no-subscriber policy reports it.
+func (d *defaultEventBus) TryDispatch(e Event) error {
+	return d.DispatchContext(context.Background(), e)
+}
+
+// DispatchContext sends the given event to its registered handlers and to all catch-all handlers
+// within the given context. Events without subscribers for their type are treated according to
+// the no-subscriber policy of the bus.
+// Every handler is called even if others fail or panic. Panics are recovered and each failure is passed
+// to the error hook as an error wrapping ErrHandlerFailed and a *SubscriberError.
+// In synchronous mode the failures are also joined and returned.
+// In asynchronous mode the handlers run on the worker pool of the bus,
+// only submissions rejected by the pool are returned.
+// The event is wrapped in a new Envelope that subscribers can get with EnvelopeFromContext.
+func (d *defaultEventBus) DispatchContext(ctx context.Context, e Event) error {
+	return d.DispatchEnvelope(ctx, Envelope{Event: e})
+}
+
+// DispatchEnvelope sends the event of the envelope to its handlers like DispatchContext.
+// Fields of the envelope that are not set are filled in the same way as for new envelopes.
+func (d *defaultEventBus) DispatchEnvelope(ctx context.Context, env Envelope) error {
+	return d.dispatchEnvelope(ctx, env, d.async)
+}
+
+// deliverEnvelope sends the event of the envelope to its handlers and waits for them, also on an asynchronous bus,
+// returning their failures. The outbox relay uses it to only mark events as sent once they were delivered.
+func (d *defaultEventBus) deliverEnvelope(ctx context.Context, env Envelope) error {
+	return d.dispatchEnvelope(ctx, env, false)
+}
 
-	if d.async {
-		for _, handler := range handlers {
-			go handler(e)
+// dispatchEnvelope sends the event of the envelope to its handlers,
+// on the worker pool of the bus if async is set and on the calling goroutine otherwise.
+func (d *defaultEventBus) dispatchEnvelope(ctx context.Context, env Envelope, async bool) error {
+	env = env.complete(ctx)
+	e := env.Event
+	registry := d.registry.Load()
+	subscriptions, policyErr := registry.targets(e)
+	errs := []error{policyErr}
+	ctx = withEnvelope(ctx, env)
+
+	if async {
+		detached := context.WithoutCancel(ctx)
+		for _, sub := range subscriptions {
+			err := d.work.submit(ctx, registry.pool, nil, func() {
+				if err := sub.invoke(detached, e, registry.interceptors); err != nil {
+					registry.reportError(detached, err, true)
+				}
+			}, func() {})
+			if err != nil && !errors.Is(err, ErrDropped) {
+				errs = append(errs, err)
+			}
 		}
-	} else {
-		for _, handler := range handlers {
-			handler(e)
+		return errors.Join(errs...)
+	}
+
+	for _, sub := range subscriptions {
+		if err := sub.invoke(ctx, e, registry.interceptors); err != nil {
+			registry.reportError(ctx, err, false)
+			errs = append(errs, err)
 		}
 	}
+	return errors.Join(errs...)
+}
+
+// reportError passes a failed handler invocation to the error hook.
+// Without a hook, asynchronous failures are logged since no caller receives them.
+func (r *eventRegistry) reportError(ctx context.Context, err error, async bool) {
+	switch {
+	case r.errorHook != nil:
+		r.errorHook(ctx, err)
+	case async:
+		logError(ctx, err)
+	}
 }
 
 // Register stores an event handler for the given event type.
 // The eventType parameter should match what Event.GetEventType() returns.
 // Multiple handlers can be registered for the same event type.
-func (d *defaultEventBus) Register(eventType string, eh EventHandler) {
-	d.handlers[eventType] = append(d.handlers[eventType], eh)
+func (d *defaultEventBus) Register(eventType string, eh EventHandler) Subscription {
+	return d.subscribe(eventType, funcName(eh), func(_ context.Context, e Event) error {
+		eh(e)
+		return nil
+	})
+}
+
+// RegisterContext stores a context-aware event handler for the given event type.
+// Multiple handlers can be registered for the same event type.
+func (d *defaultEventBus) RegisterContext(eventType string, eh ContextEventHandler) Subscription {
+	return d.subscribe(eventType, funcName(eh), eh)
+}
+
+// RegisterEnvelope stores a handler for the given event type that receives the envelope of each event.
+// Multiple handlers can be registered for the same event type.
+func (d *defaultEventBus) RegisterEnvelope(eventType string, eh EnvelopeHandler) Subscription {
+	return d.subscribe(eventType, funcName(eh), func(ctx context.Context, _ Event) error {
+		env, _ := EnvelopeFromContext(ctx)
+		return eh(ctx, env)
+	})
+}
+
+// Shutdown stops accepting events for asynchronous delivery and waits for the accepted deliveries to finish.
+// Synchronous buses deliver events on the caller's goroutine and have nothing to drain.
+// Shut down command buses publishing to this bus first, so their events can still be delivered.
+// If ctx ends first, queued deliveries are abandoned and a *ShutdownError is returned.
+func (d *defaultEventBus) Shutdown(ctx context.Context) error {
+	return d.work.shutdown(ctx)
+}
+
+// Close shuts the bus down and waits for all accepted deliveries to finish.
+func (d *defaultEventBus) Close() error {
+	return d.Shutdown(context.Background())
+}
+
+// RegisterAll stores a catch-all handler that receives every event dispatched on the bus,
+// whatever its type and whether or not it has other subscribers.
+// The returned Subscription removes the handler again.
+func (d *defaultEventBus) RegisterAll(eh ContextEventHandler) Subscription {
+	var sub *eventSubscription
+	d.update(func(r *eventRegistry) {
+		sub = d.newSubscription("", funcName(eh), eh)
+		r.catchAll = appendCopy(r.catchAll, sub)
+	})
+	return sub
+}
+
+// RegisterPattern stores a handler for all event types matching the given pattern,
+// such as "User*", "orders.*" or "orders.>".
+// Patterns without wildcards are registered like RegisterContext.
+// Panics with ErrInvalidPattern if the pattern cannot be parsed.
+func (d *defaultEventBus) RegisterPattern(pattern string, eh ContextEventHandler) Subscription {
+	p, wildcard, err := parseEventPattern(pattern)
+	if err != nil {
+		panic(err)
+	}
+	if !wildcard {
+		return d.subscribe(pattern, funcName(eh), eh)
+	}
+	var sub *eventSubscription
+	d.update(func(r *eventRegistry) {
+		sub = d.newSubscription(pattern, funcName(eh), eh)
+		sub.pattern = p
+		r.patterns = appendCopy(r.patterns, sub)
+	})
+	return sub
+}
+
+// SetNoSubscriberPolicy sets how events without subscribers for their type are treated.
+// The default policy is NoSubscriberError.
+func (d *defaultEventBus) SetNoSubscriberPolicy(policy NoSubscriberPolicy) {
+	d.update(func(r *eventRegistry) {
+		r.noSubscriberPolicy = policy
+	})
+}
+
+// SetDeadLetterHandler sets the handler that receives events without subscribers under NoSubscriberDeadLetter.
+// It is invoked like any other subscriber, including interceptors and error reporting.
+// Passing nil removes the dead-letter handler.
+func (d *defaultEventBus) SetDeadLetterHandler(eh ContextEventHandler) {
+	d.update(func(r *eventRegistry) {
+		r.deadLetter = nil
+		if eh != nil {
+			r.deadLetter = d.newSubscription("", funcName(eh), eh)
+		}
+	})
+}
+
+// SetErrorHook sets the hook that receives every failing or panicking handler invocation.
+// Without a hook, failures of asynchronous deliveries are written to the standard logger.
+func (d *defaultEventBus) SetErrorHook(hook ErrorHook) {
+	d.update(func(r *eventRegistry) {
+		r.errorHook = hook
+	})
+}
+
+// SetWorkerPool replaces the worker pool that runs the handlers of an asynchronous bus.
+// The pool can be shared with other buses to bound the total number of goroutines.
+// Synchronous buses call their handlers directly and do not use the pool.
+func (d *defaultEventBus) SetWorkerPool(pool *WorkerPool) {
+	d.update(func(r *eventRegistry) {
+		r.pool = pool
+	})
+}
+
+// Use adds interceptors that wrap every handler invocation, in synchronous and asynchronous mode.
+// Interceptors apply to handlers registered before and after the call,
+// and the interceptor added first is the outermost one.
+func (d *defaultEventBus) Use(interceptors ...EventInterceptor) {
+	d.update(func(r *eventRegistry) {
+		r.interceptors = appendCopy(r.interceptors, interceptors...)
+	})
+}
+
+// subscribe stores a handler for the given event type under a new subscriber identity.
+func (d *defaultEventBus) subscribe(eventType, name string, eh ContextEventHandler) *eventSubscription {
+	var sub *eventSubscription
+	d.update(func(r *eventRegistry) {
+		sub = d.newSubscription(eventType, name, eh)
+		r.handlers[eventType] = appendCopy(r.handlers[eventType], sub)
+	})
+	return sub
+}
+
+// newSubscription creates a subscription with a new subscriber ID. It must be called with mu held.
+func (d *defaultEventBus) newSubscription(eventType, name string, eh ContextEventHandler) *eventSubscription {
+	d.lastID++
+	return &eventSubscription{
+		bus:        d,
+		subscriber: Subscriber{ID: d.lastID, EventType: eventType, Name: name},
+		handler:    eh,
+	}
+}
+
+// update applies the given change to a clone of the registry and publishes the clone.
+func (d *defaultEventBus) update(change func(r *eventRegistry)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	r := d.registry.Load().clone()
+	change(r)
+	d.registry.Store(r)
+}
+
+// funcName returns the name the runtime reports for the given function value.
+// Closures are named after their enclosing function with a ".funcN" suffix.
+func funcName(f any) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer())
+	if fn == nil {
+		return ""
+	}
+	return fn.Name()
 }
 
 // DefaultAsyncEventBus creates a new instance of the default event bus implementation.
 // Returns an EventBus that uses string-based event type routing.
-// Event handlers will be executed concurrently using goroutines.
+// Event handlers will be executed concurrently on a worker pool created with DefaultWorkerPoolConfig.
 func DefaultAsyncEventBus() *defaultEventBus {
-	return &defaultEventBus{
-		handlers: make(map[string][]EventHandler),
-		async:    true,
-	}
+	return newEventBus(true)
 }
 
 // DefaultSyncEventBus creates a new instance of the default event bus implementation.
 // Returns an EventBus that uses string-based event type routing.
 // Event handlers will be executed synchronously (one by one).
 func DefaultSyncEventBus() *defaultEventBus {
-	return &defaultEventBus{
-		handlers: make(map[string][]EventHandler),
-		async:    false,
-	}
+	return newEventBus(false)
+}
+
+// newEventBus creates an event bus with an empty registry in the given mode.
+func newEventBus(async bool) *defaultEventBus {
+	d := &defaultEventBus{async: async}
+	d.registry.Store(&eventRegistry{
+		handlers: make(map[string][]*eventSubscription),
+		pool:     NewWorkerPool(DefaultWorkerPoolConfig()),
+	})
+	return d
 }
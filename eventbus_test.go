@@ -0,0 +1,223 @@
+package gocqrs
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTryDispatchNoHandler(t *testing.T) {
+	eventBus := DefaultSyncEventBus()
+
+	if err := eventBus.TryDispatch(testEvent{}); !errors.Is(err, ErrNoHandler) {
+		t.Errorf("Expected ErrNoHandler, got %v", err)
+	}
+
+	var received int
+	eventBus.Register("TestEvent", func(e Event) {
+		received++
+	})
+	if err := eventBus.TryDispatch(testEvent{}); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if received != 1 {
+		t.Errorf("Expected 1 event, got %d", received)
+	}
+}
+
+func TestDispatchContextJoinsHandlerErrors(t *testing.T) {
+	eventBus := DefaultSyncEventBus()
+
+	handlerErr := errors.New("projection failed")
+	var calls int
+	eventBus.RegisterContext("TestEvent", func(ctx context.Context, e Event) error {
+		calls++
+		return handlerErr
+	})
+	eventBus.Register("TestEvent", func(e Event) {
+		calls++
+	})
+
+	err := eventBus.DispatchContext(context.Background(), testEvent{})
+	if !errors.Is(err, handlerErr) || !errors.Is(err, ErrHandlerFailed) {
+		t.Errorf("Expected wrapped handler error, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Expected both handlers to be called, got %d calls", calls)
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	eventBus := DefaultSyncEventBus()
+
+	var first, second int
+	sub := eventBus.Register("TestEvent", func(e Event) {
+		first++
+	})
+	eventBus.Register("TestEvent", func(e Event) {
+		second++
+	})
+
+	eventBus.Dispatch(testEvent{})
+	sub.Unsubscribe()
+	sub.Unsubscribe()
+	eventBus.Dispatch(testEvent{})
+
+	if first != 1 || second != 2 {
+		t.Errorf("Expected 1 and 2 calls, got %d and %d", first, second)
+	}
+	if sub.Subscriber().EventType != "TestEvent" {
+		t.Errorf("Expected subscriber of TestEvent, got %+v", sub.Subscriber())
+	}
+}
+
+func TestUnsubscribeLastHandler(t *testing.T) {
+	eventBus := DefaultSyncEventBus()
+	sub := Subscribe(eventBus, func(ctx context.Context, e testEvent) error {
+		return nil
+	})
+	sub.Unsubscribe()
+
+	if err := eventBus.TryDispatch(testEvent{}); !errors.Is(err, ErrNoHandler) {
+		t.Errorf("Expected ErrNoHandler after unsubscribing, got %v", err)
+	}
+}
+
+func TestUnsubscribeDuringDispatch(t *testing.T) {
+	eventBus := DefaultSyncEventBus()
+
+	var later int
+	var sub Subscription
+	eventBus.Register("TestEvent", func(e Event) {
+		sub.Unsubscribe()
+	})
+	sub = eventBus.Register("TestEvent", func(e Event) {
+		later++
+	})
+
+	eventBus.Dispatch(testEvent{})
+	if later != 0 {
+		t.Errorf("Expected the unsubscribed handler not to run, got %d calls", later)
+	}
+}
+
+func TestNoSubscriberPolicy(t *testing.T) {
+	eventBus := DefaultSyncEventBus()
+
+	eventBus.SetNoSubscriberPolicy(NoSubscriberIgnore)
+	if err := eventBus.TryDispatch(testEvent{}); err != nil {
+		t.Errorf("Expected ignored event, got %v", err)
+	}
+
+	eventBus.SetNoSubscriberPolicy(NoSubscriberLog)
+	eventBus.Dispatch(testEvent{})
+
+	eventBus.SetNoSubscriberPolicy(NoSubscriberDeadLetter)
+	if err := eventBus.TryDispatch(testEvent{}); !errors.Is(err, ErrNoHandler) {
+		t.Errorf("Expected ErrNoHandler without dead-letter handler, got %v", err)
+	}
+
+	var deadLetters []Event
+	eventBus.SetDeadLetterHandler(func(ctx context.Context, e Event) error {
+		deadLetters = append(deadLetters, e)
+		return nil
+	})
+	if err := eventBus.TryDispatch(testEvent{}); err != nil {
+		t.Errorf("Expected no error with dead-letter handler, got %v", err)
+	}
+	eventBus.Register("TestEvent", func(e Event) {})
+	eventBus.Dispatch(testEvent{})
+	if len(deadLetters) != 1 {
+		t.Errorf("Expected 1 dead letter, got %d", len(deadLetters))
+	}
+}
+
+func TestNoSubscriberPanic(t *testing.T) {
+	eventBus := DefaultAsyncEventBus()
+	eventBus.SetNoSubscriberPolicy(NoSubscriberPanic)
+
+	defer func() {
+		err, _ := recover().(error)
+		if !errors.Is(err, ErrNoHandler) {
+			t.Errorf("Expected panic with ErrNoHandler, got %v", err)
+		}
+	}()
+	_ = eventBus.TryDispatch(testEvent{})
+}
+
+func TestRegisterAll(t *testing.T) {
+	eventBus := DefaultSyncEventBus()
+
+	var seen []string
+	sub := eventBus.RegisterAll(func(ctx context.Context, e Event) error {
+		seen = append(seen, e.GetEventType())
+		return nil
+	})
+	eventBus.Register("TestEvent", func(e Event) {})
+
+	eventBus.Dispatch(testEvent{})
+	if err := eventBus.TryDispatch(usernameEvent{}); !errors.Is(err, ErrNoHandler) {
+		t.Errorf("Expected catch-all not to count as subscriber, got %v", err)
+	}
+	if len(seen) != 2 {
+		t.Errorf("Expected catch-all to see 2 events, got %v", seen)
+	}
+	if sub.Subscriber().EventType != "" {
+		t.Errorf("Expected catch-all subscriber without event type, got %+v", sub.Subscriber())
+	}
+
+	sub.Unsubscribe()
+	eventBus.Dispatch(testEvent{})
+	if len(seen) != 2 {
+		t.Errorf("Expected no events after unsubscribing, got %v", seen)
+	}
+}
+
+type usernameEvent struct{}
+
+func (usernameEvent) GetEventType() string {
+	return "UsernameValidated"
+}
+
+func TestRegisterPattern(t *testing.T) {
+	eventBus := DefaultSyncEventBus()
+
+	var users, all int
+	sub := eventBus.RegisterPattern("User*", func(ctx context.Context, e Event) error {
+		users++
+		return nil
+	})
+	eventBus.RegisterPattern(">", func(ctx context.Context, e Event) error {
+		all++
+		return nil
+	})
+
+	if err := eventBus.TryDispatch(usernameEvent{}); err != nil {
+		t.Errorf("Expected pattern subscribers to count as subscribers, got %v", err)
+	}
+	eventBus.Dispatch(testEvent{})
+	if users != 1 || all != 2 {
+		t.Errorf("Expected 1 and 2 calls, got %d and %d", users, all)
+	}
+	if sub.Subscriber().EventType != "User*" {
+		t.Errorf("Expected subscriber of User*, got %+v", sub.Subscriber())
+	}
+
+	sub.Unsubscribe()
+	eventBus.Dispatch(usernameEvent{})
+	if users != 1 || all != 3 {
+		t.Errorf("Expected 1 and 3 calls after unsubscribing, got %d and %d", users, all)
+	}
+}
+
+func TestRegisterPatternInvalid(t *testing.T) {
+	defer func() {
+		err, _ := recover().(error)
+		if !errors.Is(err, ErrInvalidPattern) {
+			t.Errorf("Expected panic with ErrInvalidPattern, got %v", err)
+		}
+	}()
+	DefaultSyncEventBus().RegisterPattern("orders.>.created", func(ctx context.Context, e Event) error {
+		return nil
+	})
+}
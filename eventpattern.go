@@ -0,0 +1,72 @@
+package gocqrs
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidPattern is returned when an event type pattern cannot be parsed.
+// Patterns consist of non-empty tokens separated by dots, see RegisterPattern for the syntax.
+var ErrInvalidPattern = errors.New("gocqrs: invalid event type pattern")
+
+// eventPattern matches event types against a parsed subscription pattern.
+// Event types are split into tokens at dots, so "orders.line.added" has three tokens.
+type eventPattern struct {
+	// tokens holds the pattern tokens; "*" matches any token, a trailing "*" matches a token prefix
+	tokens []string
+	// tail is set when the pattern ends in ">" and matches one or more remaining tokens
+	tail bool
+}
+
+// parseEventPattern parses the given pattern.
+// The returned wildcard flag is false for patterns that only match a single event type.
+func parseEventPattern(pattern string) (p *eventPattern, wildcard bool, err error) {
+	tokens := strings.Split(pattern, ".")
+	p = &eventPattern{}
+	for i, token := range tokens {
+		switch {
+		case token == "":
+			return nil, false, fmt.Errorf("%w: %q has an empty token", ErrInvalidPattern, pattern)
+		case token == ">":
+			if i != len(tokens)-1 {
+				return nil, false, fmt.Errorf("%w: %q has '>' before its last token", ErrInvalidPattern, pattern)
+			}
+			p.tail, wildcard = true, true
+			continue
+		case strings.Contains(strings.TrimSuffix(token, "*"), "*") || strings.Contains(token, ">"):
+			return nil, false, fmt.Errorf("%w: %q has a wildcard inside token %q", ErrInvalidPattern, pattern, token)
+		case strings.HasSuffix(token, "*"):
+			wildcard = true
+		}
+		p.tokens = append(p.tokens, token)
+	}
+	return p, wildcard, nil
+}
+
+// match reports whether the event type matches the pattern.
+// Matching splits the event type, so results should be cached by the caller.
+func (p *eventPattern) match(eventType string) bool {
+	tokens := strings.Split(eventType, ".")
+	if p.tail {
+		if len(tokens) <= len(p.tokens) {
+			return false
+		}
+	} else if len(tokens) != len(p.tokens) {
+		return false
+	}
+	for i, token := range p.tokens {
+		if !matchToken(token, tokens[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchToken reports whether a single event type token matches a pattern token.
+func matchToken(pattern, token string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(token, prefix)
+	}
+	return pattern == token
+}
@@ -0,0 +1,50 @@
+package gocqrs
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEventPatternMatch(t *testing.T) {
+	tests := []struct {
+		pattern   string
+		eventType string
+		want      bool
+	}{
+		{"User*", "UserCreated", true},
+		{"User*", "UsernameValidated", true},
+		{"User*", "OrderPlaced", false},
+		{"User*", "User.Created", false},
+		{"orders.*", "orders.created", true},
+		{"orders.*", "orders.line.added", false},
+		{"orders.*", "orders", false},
+		{"orders.>", "orders.created", true},
+		{"orders.>", "orders.line.added", true},
+		{"orders.>", "orders", false},
+		{"*.created", "orders.created", true},
+		{"*.created", "orders.deleted", false},
+		{"billing.Invoice*.>", "billing.InvoiceSent.v2", true},
+		{"billing.Invoice*.>", "billing.PaymentSent.v2", false},
+		{">", "UserCreated", true},
+	}
+	for _, tt := range tests {
+		p, _, err := parseEventPattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("Expected %q to parse, got %v", tt.pattern, err)
+		}
+		if got := p.match(tt.eventType); got != tt.want {
+			t.Errorf("Expected %q matching %q to be %v, got %v", tt.pattern, tt.eventType, tt.want, got)
+		}
+	}
+}
+
+func TestParseEventPatternInvalid(t *testing.T) {
+	for _, pattern := range []string{"", "orders..created", "orders.>.created", "Us*er", "orders.a>"} {
+		if _, _, err := parseEventPattern(pattern); !errors.Is(err, ErrInvalidPattern) {
+			t.Errorf("Expected ErrInvalidPattern for %q, got %v", pattern, err)
+		}
+	}
+	if _, wildcard, _ := parseEventPattern("orders.created"); wildcard {
+		t.Errorf("Expected pattern without wildcards to be exact")
+	}
+}
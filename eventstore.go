@@ -0,0 +1,137 @@
+package gocqrs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrConcurrencyConflict is returned when events are appended to a stream whose version differs from the
+// expected version, typically because another command changed the same aggregate concurrently.
+// The returned error is a *ConcurrencyError describing the conflict.
+var ErrConcurrencyConflict = errors.New("gocqrs: concurrency conflict")
+
+const (
+	// AnyVersion appends to a stream regardless of its current version.
+	AnyVersion int64 = -1
+	// NoStream appends only if the stream does not exist yet.
+	NoStream int64 = 0
+	// EndOfStream reads a stream backward starting with its last event.
+	EndOfStream int64 = math.MaxInt64
+)
+
+// ConcurrencyError describes an append rejected because the stream was not at the expected version.
+// It wraps ErrConcurrencyConflict, so errors.Is can be used to check for it.
+type ConcurrencyError struct {
+	// StreamID identifies the stream the events were appended to
+	StreamID string
+	// Expected is the version the stream was expected to have
+	Expected int64
+	// Actual is the version the stream had
+	Actual int64
+}
+
+// Error returns a message naming the stream and both versions.
+func (e *ConcurrencyError) Error() string {
+	return fmt.Sprintf("%v: stream %s is at version %d, expected %d", ErrConcurrencyConflict, e.StreamID, e.Actual, e.Expected)
+}
+
+// Unwrap returns ErrConcurrencyConflict.
+func (e *ConcurrencyError) Unwrap() error {
+	return ErrConcurrencyConflict
+}
+
+// RecordedEvent is an event read from an EventStore.
+// The store sets the AggregateID of the envelope to the stream ID and its Version to the version of the stream
+// after the event, starting at 1.
+type RecordedEvent struct {
+	Envelope
+
+	// Position is the global position of the event in the store, starting at 1.
+	// Positions increase with every appended event, across all streams.
+	Position int64
+}
+
+// EventStore persists events in streams, usually one stream per aggregate.
+// Implementations must be safe for concurrent use.
+type EventStore interface {
+	// Append adds the envelopes to the end of the stream as a single atomic batch.
+	// The stream must be at expectedVersion, which can also be AnyVersion or NoStream,
+	// otherwise nothing is appended and a *ConcurrencyError is returned.
+	// Envelopes without ID or timestamp get a new one. Returns the recorded events.
+	Append(ctx context.Context, streamID string, expectedVersion int64, envelopes ...Envelope) ([]RecordedEvent, error)
+
+	// ReadStreamForward returns up to limit events of the stream starting at fromVersion, oldest first.
+	// A limit of zero or less returns all remaining events. Unknown streams have no events.
+	ReadStreamForward(ctx context.Context, streamID string, fromVersion int64, limit int) ([]RecordedEvent, error)
+
+	// ReadStreamBackward returns up to limit events of the stream starting at fromVersion, newest first.
+	// Pass EndOfStream to start with the last event. A limit of zero or less returns all remaining events.
+	ReadStreamBackward(ctx context.Context, streamID string, fromVersion int64, limit int) ([]RecordedEvent, error)
+
+	// ReadAll returns up to limit events of all streams starting at the global position fromPosition,
+	// in the order they were appended. A limit of zero or less returns all remaining events.
+	ReadAll(ctx context.Context, fromPosition int64, limit int) ([]RecordedEvent, error)
+}
+
+// SetEventStore sets the event store the events collected from the handlers are appended to before they are
+// published. Events are appended to the stream of their aggregate ID, events that do not implement AggregateEvent
+// or have an empty aggregate ID are only published. When an event reports a version, the stream is expected to be
+// at the version before it, so concurrent changes to the same aggregate fail with ErrConcurrencyConflict.
+// Failing to append the events fails the command. In unit-of-work mode the events are appended once the transaction
+// committed, so a rolled back command never leaves events in the store. Passing nil removes the event store.
+func (d *defaultCommandBus) SetEventStore(store EventStore) {
+	d.update(func(r *commandRegistry) {
+		r.eventStore = store
+	})
+}
+
+// appendToStore appends the envelopes to the streams of their aggregates, one batch per consecutive run
+// of envelopes of the same stream. The envelopes are updated with the versions recorded by the store.
+func appendToStore(ctx context.Context, store EventStore, envelopes []Envelope) error {
+	for start := 0; start < len(envelopes); {
+		streamID := envelopes[start].AggregateID
+		end := start + 1
+		for end < len(envelopes) && envelopes[end].AggregateID == streamID {
+			end++
+		}
+		if streamID != "" {
+			expected := AnyVersion
+			if version := envelopes[start].Version; version > 0 {
+				expected = version - 1
+			}
+			recorded, err := store.Append(ctx, streamID, expected, envelopes[start:end]...)
+			if err != nil {
+				return fmt.Errorf("gocqrs: append events to stream %s: %w", streamID, err)
+			}
+			for i, event := range recorded {
+				envelopes[start+i] = event.Envelope
+			}
+		}
+		start = end
+	}
+	return nil
+}
+
+// recordEnvelopes prepares envelopes for appending to a stream currently at the given version,
+// completing them and assigning the stream ID and consecutive versions.
+// Positions are assigned starting after the given global position.
+func recordEnvelopes(ctx context.Context, streamID string, version, position int64, envelopes []Envelope) []RecordedEvent {
+	recorded := make([]RecordedEvent, len(envelopes))
+	for i, env := range envelopes {
+		env = env.complete(ctx)
+		env.AggregateID = streamID
+		env.Version = version + int64(i) + 1
+		recorded[i] = RecordedEvent{Envelope: env, Position: position + int64(i) + 1}
+	}
+	return recorded
+}
+
+// checkVersion returns a *ConcurrencyError if a stream at the actual version does not satisfy the expected version.
+func checkVersion(streamID string, expected, actual int64) error {
+	if expected == AnyVersion || expected == actual {
+		return nil
+	}
+	return &ConcurrencyError{StreamID: streamID, Expected: expected, Actual: actual}
+}
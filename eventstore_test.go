@@ -0,0 +1,135 @@
+package gocqrs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// testEventStoreContract runs the tests every EventStore implementation must pass.
+func testEventStoreContract(t *testing.T, newStore func(t *testing.T) EventStore) {
+	ctx := context.Background()
+
+	t.Run("AppendAndRead", func(t *testing.T) {
+		store := newStore(t)
+		recorded, err := store.Append(ctx, "user-1", NoStream,
+			Envelope{Event: testEvent{Name: "first"}},
+			Envelope{Event: testEvent{Name: "second"}, Metadata: map[string]string{"tenant": "acme"}},
+		)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(recorded) != 2 || recorded[1].Version != 2 || recorded[1].AggregateID != "user-1" || recorded[1].ID == "" {
+			t.Fatalf("Expected versions assigned to the stream, got %+v", recorded)
+		}
+		if _, err := store.Append(ctx, "user-2", NoStream, Envelope{Event: testEvent{Name: "other"}}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, err := store.Append(ctx, "user-1", 2, Envelope{Event: testEvent{Name: "third"}}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		forward, err := store.ReadStreamForward(ctx, "user-1", 2, 0)
+		if err != nil || len(forward) != 2 || forward[0].Event != (testEvent{Name: "second"}) || forward[1].Version != 3 {
+			t.Errorf("Expected versions 2 and 3, got %+v and %v", forward, err)
+		}
+		if forward[0].Metadata["tenant"] != "acme" || !forward[0].Timestamp.Equal(recorded[1].Timestamp) || forward[0].ID != recorded[1].ID {
+			t.Errorf("Expected envelope to round-trip, got %+v", forward[0].Envelope)
+		}
+
+		backward, err := store.ReadStreamBackward(ctx, "user-1", EndOfStream, 2)
+		if err != nil || len(backward) != 2 || backward[0].Version != 3 || backward[1].Version != 2 {
+			t.Errorf("Expected versions 3 and 2, got %+v and %v", backward, err)
+		}
+
+		all, err := store.ReadAll(ctx, 2, 2)
+		if err != nil || len(all) != 2 || all[0].Position != 2 || all[1].AggregateID != "user-2" || all[1].Position != 3 {
+			t.Errorf("Expected positions 2 and 3, got %+v and %v", all, err)
+		}
+
+		if missing, err := store.ReadStreamForward(ctx, "missing", 1, 0); err != nil || len(missing) != 0 {
+			t.Errorf("Expected no events of unknown stream, got %v and %v", missing, err)
+		}
+	})
+
+	t.Run("ConcurrencyConflict", func(t *testing.T) {
+		store := newStore(t)
+		if _, err := store.Append(ctx, "user-1", NoStream, Envelope{Event: testEvent{}}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		_, err := store.Append(ctx, "user-1", NoStream, Envelope{Event: testEvent{}})
+		var conflict *ConcurrencyError
+		if !errors.Is(err, ErrConcurrencyConflict) || !errors.As(err, &conflict) || conflict.Actual != 1 || conflict.Expected != NoStream {
+			t.Errorf("Expected concurrency conflict at version 1, got %v", err)
+		}
+		if _, err := store.Append(ctx, "user-1", AnyVersion, Envelope{Event: testEvent{}}); err != nil {
+			t.Errorf("Expected append with any version to succeed, got %v", err)
+		}
+	})
+
+	t.Run("ConcurrentAppends", func(t *testing.T) {
+		store := newStore(t)
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		succeeded := 0
+		for range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := store.Append(ctx, "user-1", NoStream, Envelope{Event: testEvent{}}, Envelope{Event: testEvent{}})
+				if err == nil {
+					mu.Lock()
+					succeeded++
+					mu.Unlock()
+				} else if !errors.Is(err, ErrConcurrencyConflict) {
+					t.Errorf("Expected concurrency conflict, got %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		events, _ := store.ReadAll(ctx, 1, 0)
+		if succeeded != 1 || len(events) != 2 {
+			t.Errorf("Expected exactly one successful append, got %d with %d events", succeeded, len(events))
+		}
+	})
+}
+
+func TestMemoryEventStore(t *testing.T) {
+	testEventStoreContract(t, func(t *testing.T) EventStore {
+		return NewMemoryEventStore()
+	})
+}
+
+func TestCommandBusEventStore(t *testing.T) {
+	store := NewMemoryEventStore()
+	eventBus := DefaultSyncEventBus()
+	var published []Envelope
+	eventBus.RegisterEnvelope("AccountOpened", func(ctx context.Context, env Envelope) error {
+		published = append(published, env)
+		return nil
+	})
+	commandBus := DefaultCommandBus(eventBus)
+	commandBus.SetEventStore(store)
+	RegisterCommand(commandBus, func(ctx context.Context, c openAccount) ([]Event, error) {
+		return []Event{accountOpened{AccountID: c.AccountID, Version: 1}}, nil
+	})
+
+	if err := commandBus.TryExecute(openAccount{AccountID: "acc-1"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	stored, _ := store.ReadStreamForward(context.Background(), "acc-1", 1, 0)
+	if len(stored) != 1 || len(published) != 1 || stored[0].ID != published[0].ID || published[0].Version != 1 {
+		t.Fatalf("Expected the stored event to be published, got %+v and %+v", stored, published)
+	}
+
+	err := commandBus.TryExecute(openAccount{AccountID: "acc-1"})
+	if !errors.Is(err, ErrConcurrencyConflict) {
+		t.Errorf("Expected concurrency conflict for an outdated version, got %v", err)
+	}
+	if len(published) != 1 {
+		t.Errorf("Expected conflicting events not to be published, got %d", len(published))
+	}
+}
@@ -0,0 +1,253 @@
+package gocqrs
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrUnknownEventType is returned when an event is serialized or deserialized
+// whose event type was not registered with RegisterEventType.
+// The returned error also names the event type.
+var ErrUnknownEventType = errors.New("gocqrs: unknown event type")
+
+// ErrDuplicateEventType is returned when two Go types are registered for the same event type.
+var ErrDuplicateEventType = errors.New("gocqrs: event type registered twice")
+
+// EventTypeRegistry maps the event types returned by GetEventType to the Go types of the events,
+// so persisted or transmitted events can be turned back into values of their original type.
+// It is safe for concurrent use, lookups never take a lock.
+type EventTypeRegistry struct {
+	// mu serializes registrations
+	mu sync.Mutex
+	// types holds the current immutable registrations
+	types atomic.Pointer[eventTypes]
+}
+
+// eventTypes holds the registrations of an EventTypeRegistry. It is never modified once stored,
+// registrations clone it and swap in the new one.
+type eventTypes struct {
+	// goTypes maps event types to the Go types their payloads are decoded into
+	goTypes map[string]reflect.Type
+	// versions maps event types to the current schema version of their Go type
+	versions map[string]int
+	// upcasters maps event types and schema versions to the upcaster converting payloads to the next version
+	upcasters map[upcasterKey]Upcaster
+}
+
+// clone returns a copy of the registrations that can be modified.
+func (t *eventTypes) clone() *eventTypes {
+	return &eventTypes{
+		goTypes:   maps.Clone(t.goTypes),
+		versions:  maps.Clone(t.versions),
+		upcasters: maps.Clone(t.upcasters),
+	}
+}
+
+// defaultEventTypes is the registry used by RegisterEventType and DefaultEventSerializer.
+var defaultEventTypes = NewEventTypeRegistry()
+
+// NewEventTypeRegistry creates an empty event type registry.
+func NewEventTypeRegistry() *EventTypeRegistry {
+	r := &EventTypeRegistry{}
+	r.types.Store(&eventTypes{
+		goTypes:   make(map[string]reflect.Type),
+		versions:  make(map[string]int),
+		upcasters: make(map[upcasterKey]Upcaster),
+	})
+	return r
+}
+
+// DefaultEventTypes returns the registry RegisterEventType adds to.
+func DefaultEventTypes() *EventTypeRegistry {
+	return defaultEventTypes
+}
+
+// RegisterEventType registers T under the event type its zero value returns from GetEventType,
+// so events of that type can be deserialized by the stores. Events are typically registered in an init function
+// of the package defining them. T may be a pointer type, the events are then deserialized as pointers.
+// Registering a type again has no effect. It panics with ErrDuplicateEventType if another type is already
+// registered for the event type, and with ErrInvalidType if T is an interface or its event type is empty.
+func RegisterEventType[T Event]() {
+	RegisterEventTypeIn[T](defaultEventTypes)
+}
+
+// RegisterEventTypeIn registers T in the given registry, see RegisterEventType.
+func RegisterEventTypeIn[T Event](types *EventTypeRegistry) {
+	if err := types.register(reflect.TypeFor[T]()); err != nil {
+		panic(err)
+	}
+}
+
+// register adds t under the event type of its zero value.
+func (r *EventTypeRegistry) register(t reflect.Type) error {
+	if t.Kind() == reflect.Interface {
+		return fmt.Errorf("%w: event type %s is an interface", ErrInvalidType, t)
+	}
+	zero := newEventValue(t).Interface().(Event)
+	eventType := zero.GetEventType()
+	if eventType == "" {
+		return fmt.Errorf("%w: event type %s has an empty event type", ErrInvalidType, t)
+	}
+	return r.update(func(types *eventTypes) error {
+		if existing, ok := types.goTypes[eventType]; ok {
+			if existing == t {
+				return nil
+			}
+			return fmt.Errorf("%w: %s is registered for %s, cannot register %s", ErrDuplicateEventType, eventType, existing, t)
+		}
+		types.goTypes[eventType] = t
+		types.versions[eventType] = schemaVersion(zero)
+		return nil
+	})
+}
+
+// update applies fn to a copy of the registrations and stores the copy if fn succeeds.
+func (r *EventTypeRegistry) update(fn func(types *eventTypes) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	types := r.types.Load().clone()
+	if err := fn(types); err != nil {
+		return err
+	}
+	r.types.Store(types)
+	return nil
+}
+
+// Lookup returns the Go type registered for the event type.
+func (r *EventTypeRegistry) Lookup(eventType string) (reflect.Type, bool) {
+	t, ok := r.types.Load().goTypes[eventType]
+	return t, ok
+}
+
+// newEventValue returns a new zero value of t. For pointer types it points to a new zero value,
+// so methods with value receivers can be called on it and it can be decoded into.
+func newEventValue(t reflect.Type) reflect.Value {
+	if t.Kind() == reflect.Pointer {
+		return reflect.New(t.Elem())
+	}
+	return reflect.New(t).Elem()
+}
+
+// indirectType returns the type t points to, or t itself if it is not a pointer type.
+func indirectType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Pointer {
+		return t.Elem()
+	}
+	return t
+}
+
+// EventSerializer converts events to payloads and back, using the Go types of an EventTypeRegistry
+// and a Codec for the encoding. The stores use it for every event they write and read.
+type EventSerializer struct {
+	// types maps event types to the Go types payloads are decoded into
+	types *EventTypeRegistry
+	// codec encodes the events
+	codec Codec
+}
+
+// NewEventSerializer creates a serializer encoding events with the codec and decoding them into the Go types
+// registered in types. A nil registry uses DefaultEventTypes and a nil codec uses JSONCodec.
+func NewEventSerializer(types *EventTypeRegistry, codec Codec) *EventSerializer {
+	if types == nil {
+		types = defaultEventTypes
+	}
+	if codec == nil {
+		codec = JSONCodec
+	}
+	return &EventSerializer{types: types, codec: codec}
+}
+
+// DefaultEventSerializer returns a serializer using the types registered with RegisterEventType and JSONCodec.
+// It is used by the stores when none is configured.
+func DefaultEventSerializer() *EventSerializer {
+	return NewEventSerializer(nil, nil)
+}
+
+// Codec returns the codec events are encoded with.
+func (s *EventSerializer) Codec() Codec {
+	return s.codec
+}
+
+// Serialize encodes the event with the serializer's codec. Events may be passed as value or pointer,
+// whichever form was registered. Returns ErrUnknownEventType if the event type is not registered,
+// as the payload could not be decoded again.
+func (s *EventSerializer) Serialize(e Event) ([]byte, error) {
+	eventType := e.GetEventType()
+	t, ok := s.types.Lookup(eventType)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEventType, eventType)
+	}
+	if actual := reflect.TypeOf(e); indirectType(actual) != indirectType(t) {
+		return nil, fmt.Errorf("%w: event type %s is registered for %s, got %s", ErrTypeMismatch, eventType, t, actual)
+	}
+	// Pointers are encoded as the value they point to, which is what payloads are decoded into
+	v := reflect.ValueOf(e)
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil, fmt.Errorf("%w: event %s is a nil pointer", ErrInvalidType, eventType)
+		}
+		v = v.Elem()
+	}
+	payload, err := s.codec.Marshal(v.Interface())
+	if err != nil {
+		return nil, fmt.Errorf("gocqrs: encode event %s: %w", eventType, err)
+	}
+	return payload, nil
+}
+
+// Deserialize decodes a payload encoded with the serializer's codec into a value of the Go type
+// registered for the event type. The payload must have the current schema version of the type.
+// Returns ErrUnknownEventType if the event type is not registered.
+func (s *EventSerializer) Deserialize(eventType string, payload []byte) (Event, error) {
+	return s.deserialize(s.codec, eventType, 0, payload)
+}
+
+// DeserializeVersion decodes a payload of the given schema version like Deserialize, upcasting it to the
+// current schema version first. Transports receiving events from other processes use it, as the sender
+// may still use an older version of the event.
+// Returns ErrUnsupportedSchemaVersion if the payload cannot be upcast.
+func (s *EventSerializer) DeserializeVersion(eventType string, schemaVersion int, payload []byte) (Event, error) {
+	return s.deserialize(s.codec, eventType, schemaVersion, payload)
+}
+
+// deserializeWith decodes a payload of the given schema version encoded with the named codec, so events stay
+// readable when the configured codec changes. The serializer's own codec and the built-in codecs are known.
+func (s *EventSerializer) deserializeWith(codecName, eventType string, schemaVersion int, payload []byte) (Event, error) {
+	codec := s.codec
+	if codecName != codec.Name() {
+		var ok bool
+		if codec, ok = codecs[codecName]; !ok {
+			return nil, fmt.Errorf("gocqrs: decode event %s: unknown codec %q", eventType, codecName)
+		}
+	}
+	return s.deserialize(codec, eventType, schemaVersion, payload)
+}
+
+// deserialize upcasts the payload from the given schema version and decodes it with the given codec.
+// A schema version of zero skips upcasting.
+func (s *EventSerializer) deserialize(codec Codec, eventType string, schemaVersion int, payload []byte) (Event, error) {
+	types := s.types.types.Load()
+	t, ok := types.goTypes[eventType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEventType, eventType)
+	}
+	if schemaVersion != 0 {
+		var err error
+		if payload, err = types.upcast(eventType, schemaVersion, payload); err != nil {
+			return nil, err
+		}
+	}
+	v := newEventValue(t)
+	target := v.Interface()
+	if t.Kind() != reflect.Pointer {
+		target = v.Addr().Interface()
+	}
+	if err := codec.Unmarshal(payload, target); err != nil {
+		return nil, fmt.Errorf("gocqrs: decode event %s: %w", eventType, err)
+	}
+	return v.Interface().(Event), nil
+}
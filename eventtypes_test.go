@@ -0,0 +1,84 @@
+package gocqrs
+
+import (
+	"errors"
+	"testing"
+)
+
+type pointerEvent struct {
+	Name string
+}
+
+func (e *pointerEvent) GetEventType() string {
+	return "PointerEvent"
+}
+
+type otherTestEvent struct{}
+
+func (e otherTestEvent) GetEventType() string {
+	return "TestEvent"
+}
+
+func TestRegisterEventType(t *testing.T) {
+	types := NewEventTypeRegistry()
+	RegisterEventTypeIn[testEvent](types)
+	RegisterEventTypeIn[testEvent](types)
+	if got, ok := types.Lookup("TestEvent"); !ok || got.Name() != "testEvent" {
+		t.Errorf("Expected testEvent to be registered, got %v", got)
+	}
+
+	func() {
+		defer func() {
+			if err, _ := recover().(error); !errors.Is(err, ErrDuplicateEventType) {
+				t.Errorf("Expected ErrDuplicateEventType, got %v", err)
+			}
+		}()
+		RegisterEventTypeIn[otherTestEvent](types)
+	}()
+	func() {
+		defer func() {
+			if err, _ := recover().(error); !errors.Is(err, ErrInvalidType) {
+				t.Errorf("Expected ErrInvalidType, got %v", err)
+			}
+		}()
+		RegisterEventTypeIn[Event](types)
+	}()
+}
+
+func TestEventSerializer(t *testing.T) {
+	types := NewEventTypeRegistry()
+	RegisterEventTypeIn[testEvent](types)
+	RegisterEventTypeIn[*pointerEvent](types)
+
+	for _, codec := range []Codec{JSONCodec, GobCodec, BinaryCodec} {
+		t.Run(codec.Name(), func(t *testing.T) {
+			serializer := NewEventSerializer(types, codec)
+			payload, err := serializer.Serialize(testEvent{Name: "value"})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if e, err := serializer.Deserialize("TestEvent", payload); err != nil || e != (testEvent{Name: "value"}) {
+				t.Errorf("Expected testEvent, got %v and %v", e, err)
+			}
+
+			payload, err = serializer.Serialize(&pointerEvent{Name: "pointer"})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if e, err := serializer.Deserialize("PointerEvent", payload); err != nil || e.(*pointerEvent).Name != "pointer" {
+				t.Errorf("Expected *pointerEvent, got %v and %v", e, err)
+			}
+		})
+	}
+
+	serializer := NewEventSerializer(types, nil)
+	if _, err := serializer.Deserialize("Missing", []byte("{}")); !errors.Is(err, ErrUnknownEventType) {
+		t.Errorf("Expected ErrUnknownEventType on decode, got %v", err)
+	}
+	if _, err := serializer.Serialize(otherTestEvent{}); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch for a different type, got %v", err)
+	}
+	if _, err := NewEventSerializer(NewEventTypeRegistry(), nil).Serialize(testEvent{}); !errors.Is(err, ErrUnknownEventType) {
+		t.Errorf("Expected ErrUnknownEventType on encode, got %v", err)
+	}
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 
 	"github.com/avanboxel/gocqrs"
@@ -10,20 +12,22 @@ type GetUsernameQuery struct {
 	ID int
 }
 
+// Fake username data based on ID
+var usernames = map[int]string{
+	1: "john_doe",
+	2: "jane_smith",
+	3: "bob_wilson",
+	4: "alice_johnson",
+	5: "charlie_brown",
+}
+
+var ErrUnknownUser = errors.New("unknown user")
+
 type GetUsernameQueryHandler struct{}
 
 func (h *GetUsernameQueryHandler) Handle(q gocqrs.Query) gocqrs.QueryResult {
 	getUsernameQuery := q.(GetUsernameQuery)
 
-	// Fake username data based on ID
-	usernames := map[int]string{
-		1: "john_doe",
-		2: "jane_smith",
-		3: "bob_wilson",
-		4: "alice_johnson",
-		5: "charlie_brown",
-	}
-
 	if username, exists := usernames[getUsernameQuery.ID]; exists {
 		return gocqrs.QueryResult{
 			Payload: username,
@@ -37,6 +41,15 @@ func (h *GetUsernameQueryHandler) Handle(q gocqrs.Query) gocqrs.QueryResult {
 	}
 }
 
+// GetUsername is the typed equivalent of GetUsernameQueryHandler,
+// registered with gocqrs.RegisterQuery and called with gocqrs.Ask.
+func GetUsername(ctx context.Context, q GetUsernameQuery) (string, error) {
+	if username, exists := usernames[q.ID]; exists {
+		return username, nil
+	}
+	return "", ErrUnknownUser
+}
+
 func main() {
 	queryBus := gocqrs.DefaultQueryBus()
 
@@ -53,4 +66,15 @@ func main() {
 			fmt.Printf("User ID %d: %s (not found)\n", i, result.Payload)
 		}
 	}
+
+	// The same lookup with typed registration, no type assertions needed
+	typedQueryBus := gocqrs.DefaultQueryBus()
+	gocqrs.RegisterQuery(typedQueryBus, GetUsername)
+
+	username, err := gocqrs.Ask[string](context.Background(), typedQueryBus, GetUsernameQuery{ID: 2})
+	if err != nil {
+		fmt.Printf("User ID 2: %v\n", err)
+	} else {
+		fmt.Printf("User ID 2: %s (typed)\n", username)
+	}
 }
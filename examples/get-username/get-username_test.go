@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"testing"
 
 	"github.com/avanboxel/gocqrs"
@@ -43,3 +45,22 @@ func TestGetUsernameQuery(t *testing.T) {
 		}
 	}
 }
+
+func TestGetUsernameTypedQuery(t *testing.T) {
+	queryBus := gocqrs.DefaultQueryBus()
+	gocqrs.RegisterQuery(queryBus, GetUsername)
+
+	username, err := gocqrs.Ask[string](context.Background(), queryBus, GetUsernameQuery{ID: 1})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if username != "john_doe" {
+		t.Errorf("Expected john_doe, got %s", username)
+	}
+
+	// Non-existent user
+	_, err = gocqrs.Ask[string](context.Background(), queryBus, GetUsernameQuery{ID: 999})
+	if !errors.Is(err, ErrUnknownUser) {
+		t.Errorf("Expected ErrUnknownUser, got %v", err)
+	}
+}
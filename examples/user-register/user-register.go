@@ -21,6 +21,11 @@ func (e UserRegistered) GetEventType() string {
 	return "UserRegistered"
 }
 
+func init() {
+	// Register the event so stores can turn persisted events back into UserRegistered values
+	gocqrs.RegisterEventType[UserRegistered]()
+}
+
 type RegisterCommandHandler struct {
 	events []gocqrs.Event
 }
@@ -44,3 +49,9 @@ func (r *RegisterCommandHandler) Handle(c gocqrs.Command) gocqrs.CommandHandler
 func (r *RegisterCommandHandler) CollectEvents() []gocqrs.Event {
 	return r.events
 }
+
+// ClearEvents discards the collected events once the bus has dispatched them,
+// so the shared handler does not keep the events of every registration.
+func (r *RegisterCommandHandler) ClearEvents() {
+	r.events = nil
+}
@@ -1,6 +1,7 @@
 package userregister
 
 import (
+	"context"
 	"testing"
 
 	"github.com/avanboxel/gocqrs"
@@ -38,7 +39,12 @@ func TestDispatchUserRegister(t *testing.T) {
 
 	// Verify event was dispatched
 	if len(receivedEvents) != 1 {
-		t.Errorf("Expected 1 event, got %d", len(receivedEvents))
+		t.Fatalf("Expected 1 event, got %d", len(receivedEvents))
+	}
+
+	// Verify the shared handler does not keep the dispatched event
+	if events := registerHandler.CollectEvents(); len(events) != 0 {
+		t.Errorf("Expected the handler's events to be cleared, got %d", len(events))
 	}
 
 	// Verify the event is UserRegistered
@@ -53,3 +59,62 @@ func TestDispatchUserRegister(t *testing.T) {
 		t.Error("Expected UserRegistered event")
 	}
 }
+
+func TestExecuteUserRegisterWithFactory(t *testing.T) {
+	// Track events received
+	var receivedEvents []gocqrs.Event
+
+	// Create event bus and register event handler
+	eventBus := gocqrs.DefaultSyncEventBus()
+	eventBus.Register("UserRegistered", func(e gocqrs.Event) {
+		receivedEvents = append(receivedEvents, e)
+	})
+
+	// Create command bus and register a fresh handler per execution
+	commandBus := gocqrs.DefaultCommandBus(eventBus)
+	commandBus.Register(RegisterCommand{}, gocqrs.CommandHandlerFactory(func() gocqrs.CommandHandler {
+		return &RegisterCommandHandler{}
+	}))
+
+	// Execute two registrations
+	commandBus.Execute(RegisterCommand{Username: "first", Email: "first@example.com"})
+	commandBus.Execute(RegisterCommand{Username: "second", Email: "second@example.com"})
+
+	// Verify each execution dispatched only its own event
+	if len(receivedEvents) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(receivedEvents))
+	}
+	if userRegistered := receivedEvents[1].(UserRegistered); userRegistered.Username != "second" {
+		t.Errorf("Expected username 'second', got '%s'", userRegistered.Username)
+	}
+}
+
+func TestUserRegisteredFileEventStore(t *testing.T) {
+	ctx := context.Background()
+	registered := UserRegistered{Username: "testuser", Email: "test@example.com"}
+	for _, codec := range []gocqrs.Codec{gocqrs.JSONCodec, gocqrs.GobCodec, gocqrs.BinaryCodec} {
+		t.Run(codec.Name(), func(t *testing.T) {
+			dir := t.TempDir()
+			config := gocqrs.FileEventStoreConfig{Serializer: gocqrs.NewEventSerializer(nil, codec)}
+			store, err := gocqrs.OpenFileEventStore(dir, config)
+			if err != nil {
+				t.Fatalf("Expected event store to open, got %v", err)
+			}
+			if _, err := store.Append(ctx, "user-testuser", gocqrs.NoStream, gocqrs.Envelope{Event: registered}); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			store.Close()
+
+			// Reopen the store with the default serializer, events are decoded with the codec they were stored with
+			store, err = gocqrs.OpenFileEventStore(dir, gocqrs.FileEventStoreConfig{})
+			if err != nil {
+				t.Fatalf("Expected event store to reopen, got %v", err)
+			}
+			defer store.Close()
+			events, err := store.ReadStreamForward(ctx, "user-testuser", 1, 0)
+			if err != nil || len(events) != 1 || events[0].Event != registered {
+				t.Errorf("Expected UserRegistered to round-trip, got %+v and %v", events, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,642 @@
+package gocqrs
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FsyncPolicy determines when a FileEventStore syncs appended events to disk.
+type FsyncPolicy int
+
+const (
+	// FsyncAlways syncs every append before it returns, no acknowledged event is lost on a crash.
+	FsyncAlways FsyncPolicy = iota
+	// FsyncInterval syncs appended events periodically,
+	// events appended within the last interval can be lost when the machine crashes.
+	FsyncInterval
+	// FsyncNever leaves syncing to the operating system.
+	FsyncNever
+)
+
+// FileEventStoreConfig configures a FileEventStore.
+// Zero values are replaced by the defaults of DefaultFileEventStoreConfig.
+type FileEventStoreConfig struct {
+	// Serializer converts events to payloads and back
+	Serializer *EventSerializer
+	// Fsync determines when appended events are synced to disk
+	Fsync FsyncPolicy
+	// FsyncInterval is the time between two syncs under FsyncInterval
+	FsyncInterval time.Duration
+	// SegmentSize is the size in bytes after which a new segment file is started
+	SegmentSize int64
+}
+
+// DefaultFileEventStoreConfig returns the configuration used for zero values of FileEventStoreConfig.
+// It uses DefaultEventSerializer, syncs every append and starts a new segment every 64 MiB.
+func DefaultFileEventStoreConfig() FileEventStoreConfig {
+	return FileEventStoreConfig{
+		Serializer:    DefaultEventSerializer(),
+		Fsync:         FsyncAlways,
+		FsyncInterval: time.Second,
+		SegmentSize:   64 << 20,
+	}
+}
+
+// fileIndexEntrySize is the size of an entry in a stream index file:
+// the first position of the segment, the offset of the record within it and the length of the record.
+const fileIndexEntrySize = 20
+
+// FileEventStore is an EventStore that appends events as newline-delimited JSON to segment files in a directory.
+// Each segment is named after the global position of its first event. A binary index file per stream
+// records where the events of the stream are stored, so streams are read without scanning the segments.
+//
+// When the store is opened, a record torn by a crash during a write is truncated from the last segment
+// and the indexes are repaired from it. Segments are synced before a new one is started, whatever the fsync policy.
+// The directory must not be used by more than one store at a time.
+type FileEventStore struct {
+	// mu guards the segments, positions and caches; appends hold it exclusively
+	mu sync.RWMutex
+	// dir is the directory holding the segments and index directories
+	dir string
+	// config holds the store configuration with defaults applied
+	config FileEventStoreConfig
+	// segments holds the open segment files, ordered by their first position
+	segments []*fileSegment
+	// position is the global position of the last appended event
+	position int64
+	// versions caches the current version of the streams appended to
+	versions map[string]int64
+	// dirtyIndexes holds the index files written since the last sync under FsyncInterval
+	dirtyIndexes map[string]struct{}
+	// dirtySegment is set when the last segment was written since the last sync under FsyncInterval
+	dirtySegment bool
+	// closed is set once the store is closed
+	closed bool
+	// stop is closed to stop the sync goroutine of FsyncInterval, nil without it or once the store is closed
+	stop chan struct{}
+	// done is closed once the sync goroutine exited
+	done chan struct{}
+}
+
+// fileSegment is a segment file of a FileEventStore.
+type fileSegment struct {
+	// first is the global position of the first event in the segment
+	first int64
+	// file is the open segment file
+	file *os.File
+	// size is the size of the valid part of the segment
+	size int64
+}
+
+// fileEventRecord is a line of a segment file.
+type fileEventRecord struct {
+	// Position is the global position of the event
+	Position int64 `json:"position"`
+	storedEnvelope
+}
+
+// fileIndexEntry locates a record of a stream in the segments.
+type fileIndexEntry struct {
+	// segment is the first position of the segment holding the record
+	segment int64
+	// offset is the offset of the record within the segment
+	offset int64
+	// length is the length of the record, without its newline
+	length int
+}
+
+// OpenFileEventStore opens the event store in the given directory, creating it if it does not exist.
+// A record torn by a crash is truncated from the last segment and the stream indexes are repaired.
+func OpenFileEventStore(dir string, config FileEventStoreConfig) (*FileEventStore, error) {
+	defaults := DefaultFileEventStoreConfig()
+	if config.Serializer == nil {
+		config.Serializer = defaults.Serializer
+	}
+	if config.FsyncInterval <= 0 {
+		config.FsyncInterval = defaults.FsyncInterval
+	}
+	if config.SegmentSize <= 0 {
+		config.SegmentSize = defaults.SegmentSize
+	}
+	for _, sub := range []string{"segments", "index"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &FileEventStore{
+		dir:          dir,
+		config:       config,
+		versions:     make(map[string]int64),
+		dirtyIndexes: make(map[string]struct{}),
+	}
+	if err := s.load(); err != nil {
+		s.closeSegments()
+		return nil, err
+	}
+	if config.Fsync == FsyncInterval {
+		s.stop, s.done = make(chan struct{}), make(chan struct{})
+		go s.syncPeriodically(s.stop, s.done)
+	}
+	return s, nil
+}
+
+// load opens the segments, recovers the last one and repairs the indexes from it.
+func (s *FileEventStore) load() error {
+	names, err := os.ReadDir(filepath.Join(s.dir, "segments"))
+	if err != nil {
+		return err
+	}
+	for _, entry := range names {
+		name, ok := strings.CutSuffix(entry.Name(), ".jsonl")
+		if !ok {
+			continue
+		}
+		first, err := strconv.ParseInt(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		f, err := os.OpenFile(filepath.Join(s.dir, "segments", entry.Name()), os.O_RDWR, 0o644)
+		if err != nil {
+			return err
+		}
+		segment := &fileSegment{first: first, file: f}
+		s.segments = append(s.segments, segment)
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		segment.size = info.Size()
+	}
+	slices.SortFunc(s.segments, func(a, b *fileSegment) int {
+		return cmp.Compare(a.first, b.first)
+	})
+	if len(s.segments) == 0 {
+		return s.startSegment(1)
+	}
+
+	last := s.segments[len(s.segments)-1]
+	s.position = last.first - 1
+	var recovered []fileEventRecord
+	var entries []fileIndexEntry
+	var offset int64
+	last.size, err = recoverLines(last.file, func(line []byte) error {
+		var record fileEventRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return err
+		}
+		if record.Position != s.position+1 {
+			return fmt.Errorf("unexpected position %d after %d", record.Position, s.position)
+		}
+		s.position = record.Position
+		recovered = append(recovered, record)
+		entries = append(entries, fileIndexEntry{segment: last.first, offset: offset, length: len(line)})
+		offset += int64(len(line)) + 1
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return s.repairIndexes(last.first, recovered, entries)
+}
+
+// repairIndexes removes the index entries pointing into the last segment and recreates them from its records,
+// so indexes that lag behind or point past a truncated record are consistent with the segment again.
+func (s *FileEventStore) repairIndexes(segment int64, records []fileEventRecord, entries []fileIndexEntry) error {
+	indexes, err := os.ReadDir(filepath.Join(s.dir, "index"))
+	if err != nil {
+		return err
+	}
+	for _, index := range indexes {
+		if err := truncateIndex(filepath.Join(s.dir, "index", index.Name()), segment); err != nil {
+			return err
+		}
+	}
+	for i, record := range records {
+		path := s.indexPath(record.AggregateID)
+		version, err := indexLength(path)
+		if err != nil {
+			return err
+		}
+		if record.Version != version+1 {
+			return fmt.Errorf("%w: stream %s continues at version %d after %d", ErrCorruptFile, record.AggregateID, record.Version, version)
+		}
+		if err := s.writeIndex(path, version, entries[i:i+1], true); err != nil {
+			return err
+		}
+	}
+	return syncDir(filepath.Join(s.dir, "index"))
+}
+
+// truncateIndex removes the trailing entries of the index file that point into the given segment or later ones.
+func truncateIndex(path string, segment int64) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size() - info.Size()%fileIndexEntrySize
+	for size > 0 {
+		var buf [fileIndexEntrySize]byte
+		if _, err := f.ReadAt(buf[:], size-fileIndexEntrySize); err != nil {
+			return err
+		}
+		if decodeIndexEntry(buf[:]).segment < segment {
+			break
+		}
+		size -= fileIndexEntrySize
+	}
+	if size == info.Size() {
+		return nil
+	}
+	if err := f.Truncate(size); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// startSegment creates a new segment starting at the given global position and makes it the last one.
+func (s *FileEventStore) startSegment(first int64) error {
+	path := filepath.Join(s.dir, "segments", fmt.Sprintf("%020d.jsonl", first))
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	s.segments = append(s.segments, &fileSegment{first: first, file: f})
+	return syncDir(filepath.Join(s.dir, "segments"))
+}
+
+// Append adds the envelopes to the end of the stream if it is at the expected version.
+// The events are written to the last segment first, then to the index of the stream.
+func (s *FileEventStore) Append(ctx context.Context, streamID string, expectedVersion int64, envelopes ...Envelope) ([]RecordedEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, os.ErrClosed
+	}
+	indexPath := s.indexPath(streamID)
+	version, ok := s.versions[streamID]
+	if !ok {
+		var err error
+		if version, err = indexLength(indexPath); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkVersion(streamID, expectedVersion, version); err != nil {
+		return nil, err
+	}
+	if len(envelopes) == 0 {
+		return nil, nil
+	}
+
+	recorded := recordEnvelopes(ctx, streamID, version, s.position, envelopes)
+	var data []byte
+	lengths := make([]int, len(recorded))
+	for i, event := range recorded {
+		stored, err := encodeEnvelope(event.Envelope, s.config.Serializer)
+		if err != nil {
+			return nil, err
+		}
+		line, err := json.Marshal(fileEventRecord{Position: event.Position, storedEnvelope: stored})
+		if err != nil {
+			return nil, err
+		}
+		lengths[i] = len(line)
+		data = append(append(data, line...), '\n')
+	}
+
+	segment, err := s.writableSegment()
+	if err != nil {
+		return nil, err
+	}
+	sync := s.config.Fsync == FsyncAlways
+	size, err := appendLines(segment.file, segment.size, data, sync)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]fileIndexEntry, len(recorded))
+	offset := segment.size
+	for i, length := range lengths {
+		entries[i] = fileIndexEntry{segment: segment.first, offset: offset, length: length}
+		offset += int64(length) + 1
+	}
+	if err := s.writeIndex(indexPath, version, entries, sync); err != nil {
+		// Without its index entries the events would be unreachable, remove them from the segment again
+		_ = segment.file.Truncate(segment.size)
+		return nil, err
+	}
+
+	segment.size = size
+	s.position += int64(len(recorded))
+	s.versions[streamID] = version + int64(len(recorded))
+	if s.config.Fsync == FsyncInterval {
+		s.dirtySegment = true
+		s.dirtyIndexes[indexPath] = struct{}{}
+	}
+	return recorded, nil
+}
+
+// writableSegment returns the last segment, starting a new one first if it is full.
+// The full segment and all indexes are synced before the new segment is started. It must be called with mu held.
+func (s *FileEventStore) writableSegment() (*fileSegment, error) {
+	last := s.segments[len(s.segments)-1]
+	if last.size < s.config.SegmentSize {
+		return last, nil
+	}
+	if err := s.syncDirty(true); err != nil {
+		return nil, err
+	}
+	if err := s.startSegment(s.position + 1); err != nil {
+		return nil, err
+	}
+	return s.segments[len(s.segments)-1], nil
+}
+
+// writeIndex appends the entries to the index file at path, which holds the given number of entries.
+func (s *FileEventStore) writeIndex(path string, version int64, entries []fileIndexEntry, sync bool) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	data := make([]byte, 0, len(entries)*fileIndexEntrySize)
+	for _, entry := range entries {
+		data = binary.BigEndian.AppendUint64(data, uint64(entry.segment))
+		data = binary.BigEndian.AppendUint64(data, uint64(entry.offset))
+		data = binary.BigEndian.AppendUint32(data, uint32(entry.length))
+	}
+	_, err = appendLines(f, version*fileIndexEntrySize, data, sync)
+	return errors.Join(err, f.Close())
+}
+
+// decodeIndexEntry decodes an entry of an index file.
+func decodeIndexEntry(buf []byte) fileIndexEntry {
+	return fileIndexEntry{
+		segment: int64(binary.BigEndian.Uint64(buf[0:8])),
+		offset:  int64(binary.BigEndian.Uint64(buf[8:16])),
+		length:  int(binary.BigEndian.Uint32(buf[16:20])),
+	}
+}
+
+// indexPath returns the path of the index file of the stream.
+// Stream IDs are hashed, so they can contain any character.
+func (s *FileEventStore) indexPath(streamID string) string {
+	sum := sha256.Sum256([]byte(streamID))
+	return filepath.Join(s.dir, "index", hex.EncodeToString(sum[:])+".idx")
+}
+
+// indexLength returns the number of entries in the index file at path, zero if it does not exist.
+func indexLength(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size() / fileIndexEntrySize, nil
+}
+
+// ReadStreamForward returns up to limit events of the stream starting at fromVersion, oldest first.
+func (s *FileEventStore) ReadStreamForward(ctx context.Context, streamID string, fromVersion int64, limit int) ([]RecordedEvent, error) {
+	return s.readStream(ctx, streamID, func(length int64) (int64, int64, bool) {
+		start := max(fromVersion-1, 0)
+		end := length
+		if limit > 0 {
+			end = min(end, start+int64(limit))
+		}
+		return start, end, false
+	})
+}
+
+// ReadStreamBackward returns up to limit events of the stream starting at fromVersion, newest first.
+func (s *FileEventStore) ReadStreamBackward(ctx context.Context, streamID string, fromVersion int64, limit int) ([]RecordedEvent, error) {
+	return s.readStream(ctx, streamID, func(length int64) (int64, int64, bool) {
+		end := min(fromVersion, length)
+		start := int64(0)
+		if limit > 0 {
+			start = max(end-int64(limit), 0)
+		}
+		return start, end, true
+	})
+}
+
+// readStream reads the index entries in the range returned by bounds for the number of entries of the stream,
+// and the events they point to. The events are returned in reverse order if bounds asks for it.
+func (s *FileEventStore) readStream(ctx context.Context, streamID string, bounds func(length int64) (start, end int64, reverse bool)) ([]RecordedEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, os.ErrClosed
+	}
+	f, err := os.Open(s.indexPath(streamID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	start, end, reverse := bounds(info.Size() / fileIndexEntrySize)
+	if start >= end {
+		return nil, nil
+	}
+	buf := make([]byte, (end-start)*fileIndexEntrySize)
+	if _, err := f.ReadAt(buf, start*fileIndexEntrySize); err != nil {
+		return nil, err
+	}
+
+	events := make([]RecordedEvent, 0, end-start)
+	for i := 0; i < len(buf); i += fileIndexEntrySize {
+		event, err := s.readEntry(decodeIndexEntry(buf[i : i+fileIndexEntrySize]))
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if reverse {
+		slices.Reverse(events)
+	}
+	return events, nil
+}
+
+// readEntry reads and decodes the record the index entry points to. It must be called with mu held.
+func (s *FileEventStore) readEntry(entry fileIndexEntry) (RecordedEvent, error) {
+	i, found := slices.BinarySearchFunc(s.segments, entry.segment, func(segment *fileSegment, first int64) int {
+		return cmp.Compare(segment.first, first)
+	})
+	if !found {
+		return RecordedEvent{}, fmt.Errorf("%w: index points to missing segment %d", ErrCorruptFile, entry.segment)
+	}
+	line := make([]byte, entry.length)
+	if _, err := s.segments[i].file.ReadAt(line, entry.offset); err != nil {
+		return RecordedEvent{}, err
+	}
+	return s.decodeRecord(line)
+}
+
+// decodeRecord decodes a line of a segment into the event it records.
+func (s *FileEventStore) decodeRecord(line []byte) (RecordedEvent, error) {
+	var record fileEventRecord
+	if err := json.Unmarshal(line, &record); err != nil {
+		return RecordedEvent{}, fmt.Errorf("%w: %w", ErrCorruptFile, err)
+	}
+	env, err := record.decode(s.config.Serializer)
+	if err != nil {
+		return RecordedEvent{}, err
+	}
+	return RecordedEvent{Envelope: env, Position: record.Position}, nil
+}
+
+// ReadAll returns up to limit events of all streams starting at the global position fromPosition.
+// The segments are scanned starting with the one holding fromPosition.
+func (s *FileEventStore) ReadAll(ctx context.Context, fromPosition int64, limit int) ([]RecordedEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, os.ErrClosed
+	}
+	first := 0
+	for i, segment := range s.segments {
+		if segment.first <= fromPosition {
+			first = i
+		}
+	}
+
+	var events []RecordedEvent
+	for _, segment := range s.segments[first:] {
+		reader := bufio.NewReader(io.NewSectionReader(segment.file, 0, segment.size))
+		for limit <= 0 || len(events) < limit {
+			line, err := reader.ReadBytes('\n')
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			var position struct {
+				Position int64 `json:"position"`
+			}
+			if err := json.Unmarshal(line, &position); err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrCorruptFile, err)
+			}
+			if position.Position < fromPosition {
+				continue
+			}
+			event, err := s.decodeRecord(line)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// syncPeriodically syncs the written files every fsync interval until stop is closed.
+func (s *FileEventStore) syncPeriodically(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(s.config.FsyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			err := s.syncDirty(false)
+			s.mu.Unlock()
+			if err != nil {
+				logError(context.Background(), fmt.Errorf("gocqrs: sync file event store: %w", err))
+			}
+		}
+	}
+}
+
+// syncDirty syncs the last segment and the index files written since the last sync.
+// With all set, the last segment is synced even if it was already synced by its appends.
+// It must be called with mu held.
+func (s *FileEventStore) syncDirty(all bool) error {
+	if s.dirtySegment || all {
+		if err := s.segments[len(s.segments)-1].file.Sync(); err != nil {
+			return err
+		}
+		s.dirtySegment = false
+	}
+	for path := range s.dirtyIndexes {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		err = errors.Join(f.Sync(), f.Close())
+		if err != nil {
+			return err
+		}
+		delete(s.dirtyIndexes, path)
+	}
+	return syncDir(filepath.Join(s.dir, "index"))
+}
+
+// Close syncs outstanding writes and closes the segment files. The store cannot be used afterwards.
+// Closing it again has no effect.
+func (s *FileEventStore) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	stop, done := s.stop, s.done
+	s.stop, s.done = nil, nil
+	s.mu.Unlock()
+	// The sync goroutine takes mu, so it is stopped without holding it
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.syncDirty(s.config.Fsync != FsyncNever)
+	return errors.Join(err, s.closeSegments())
+}
+
+// closeSegments closes all open segment files.
+func (s *FileEventStore) closeSegments() error {
+	var errs []error
+	for _, segment := range s.segments {
+		errs = append(errs, segment.file.Close())
+	}
+	return errors.Join(errs...)
+}
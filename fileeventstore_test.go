@@ -0,0 +1,129 @@
+package gocqrs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestEventStore(t *testing.T, dir string, config FileEventStoreConfig) *FileEventStore {
+	t.Helper()
+	if config.Serializer == nil {
+		config.Serializer = newTestSerializer(JSONCodec)
+	}
+	store, err := OpenFileEventStore(dir, config)
+	if err != nil {
+		t.Fatalf("Expected event store to open, got %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestFileEventStore(t *testing.T) {
+	testEventStoreContract(t, func(t *testing.T) EventStore {
+		return openTestEventStore(t, t.TempDir(), FileEventStoreConfig{})
+	})
+}
+
+func TestFileEventStoreRotation(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := openTestEventStore(t, dir, FileEventStoreConfig{SegmentSize: 512, Fsync: FsyncNever})
+	for i := range 20 {
+		if _, err := store.Append(ctx, "user-1", int64(i), Envelope{Event: testEvent{Name: "event"}}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	store.Close()
+
+	segments, _ := os.ReadDir(filepath.Join(dir, "segments"))
+	if len(segments) < 2 {
+		t.Fatalf("Expected events to be spread over several segments, got %d", len(segments))
+	}
+	reopened := openTestEventStore(t, dir, FileEventStoreConfig{SegmentSize: 512})
+	events, err := reopened.ReadStreamBackward(ctx, "user-1", EndOfStream, 0)
+	if err != nil || len(events) != 20 || events[0].Version != 20 || events[19].Position != 1 {
+		t.Fatalf("Expected 20 events across segments, got %d and %v", len(events), err)
+	}
+	all, err := reopened.ReadAll(ctx, 15, 3)
+	if err != nil || len(all) != 3 || all[0].Position != 15 || all[2].Version != 17 {
+		t.Errorf("Expected positions 15 to 17, got %+v and %v", all, err)
+	}
+	if _, err := reopened.Append(ctx, "user-1", 20, Envelope{Event: testEvent{}}); err != nil {
+		t.Errorf("Expected append after reopening to continue the stream, got %v", err)
+	}
+}
+
+func TestFileEventStoreRecovery(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := openTestEventStore(t, dir, FileEventStoreConfig{})
+	if _, err := store.Append(ctx, "user-1", NoStream, Envelope{Event: testEvent{Name: "kept"}}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := store.Append(ctx, "user-2", NoStream, Envelope{Event: testEvent{Name: "torn"}}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	store.Close()
+
+	// Simulate a crash halfway through writing the last record, after its index entry was written
+	segment := filepath.Join(dir, "segments", "00000000000000000001.jsonl")
+	info, _ := os.Stat(segment)
+	if err := os.Truncate(segment, info.Size()-10); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := openTestEventStore(t, dir, FileEventStoreConfig{})
+	if events, err := reopened.ReadStreamForward(ctx, "user-2", 1, 0); err != nil || len(events) != 0 {
+		t.Errorf("Expected torn event to be dropped, got %+v and %v", events, err)
+	}
+	if events, err := reopened.ReadAll(ctx, 1, 0); err != nil || len(events) != 1 || events[0].Event != (testEvent{Name: "kept"}) {
+		t.Errorf("Expected only the intact event, got %+v and %v", events, err)
+	}
+	recorded, err := reopened.Append(ctx, "user-2", NoStream, Envelope{Event: testEvent{Name: "retried"}})
+	if err != nil || recorded[0].Position != 2 {
+		t.Errorf("Expected torn position to be reused, got %+v and %v", recorded, err)
+	}
+}
+
+func TestFileEventStoreBinaryCodec(t *testing.T) {
+	testEventStoreContract(t, func(t *testing.T) EventStore {
+		return openTestEventStore(t, t.TempDir(), FileEventStoreConfig{Serializer: newTestSerializer(BinaryCodec)})
+	})
+}
+
+func TestFileEventStoreFsyncInterval(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := openTestEventStore(t, dir, FileEventStoreConfig{Fsync: FsyncInterval, FsyncInterval: time.Millisecond})
+	if _, err := store.Append(ctx, "user-1", NoStream, Envelope{Event: testEvent{Name: "synced"}}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		store.mu.Lock()
+		dirty := store.dirtySegment || len(store.dirtyIndexes) > 0
+		store.mu.Unlock()
+		if !dirty {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the appended event to be synced periodically")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Errorf("Expected closing again to have no effect, got %v", err)
+	}
+	reopened := openTestEventStore(t, dir, FileEventStoreConfig{})
+	if events, err := reopened.ReadStreamForward(ctx, "user-1", 1, 0); err != nil || len(events) != 1 {
+		t.Errorf("Expected the synced event after reopening, got %+v and %v", events, err)
+	}
+}
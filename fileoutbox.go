@@ -0,0 +1,212 @@
+package gocqrs
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"slices"
+	"sync"
+)
+
+// fileOutboxCompaction is the number of sent records after which the outbox file is rewritten
+// with only the pending envelopes.
+const fileOutboxCompaction = 1024
+
+// FileOutboxStore is an OutboxStore that keeps the outbox in a single append-only file.
+// Every change is appended as a line of JSON and synced to disk before it is acknowledged,
+// the pending envelopes are also kept in memory. The file is rewritten once all envelopes
+// have been sent or enough sent records accumulated.
+// The store cannot take part in the transaction of a command. It implements OutboxDiscarder instead,
+// so the command bus discards the events it saved when the transaction fails.
+type FileOutboxStore struct {
+	// mu serializes access to the file and the pending envelopes
+	mu sync.Mutex
+	// path is the location of the outbox file
+	path string
+	// serializer converts events to payloads and back
+	serializer *EventSerializer
+	// file is the open outbox file, nil once the store is closed
+	file *os.File
+	// size is the size of the valid part of the file
+	size int64
+	// pending holds the envelopes that have not been sent, oldest first
+	pending []storedEnvelope
+	// sent is the number of sent and discarded records written since the file was last rewritten
+	sent int
+}
+
+// fileOutboxRecord is a line of the outbox file.
+// It either adds a pending envelope, marks envelopes as sent or discards them.
+type fileOutboxRecord struct {
+	// Envelope is the envelope added to the outbox
+	Envelope *storedEnvelope `json:"envelope,omitempty"`
+	// Sent holds the IDs of the envelopes that were sent
+	Sent []string `json:"sent,omitempty"`
+	// Discarded holds the IDs of the envelopes that were dropped without being sent
+	Discarded []string `json:"discarded,omitempty"`
+}
+
+// OpenFileOutboxStore opens the outbox file at path, creating it if it does not exist.
+// Pending envelopes are loaded from the file, a record torn by a crash during a write is discarded.
+// Events are converted to payloads and back with the serializer, nil for DefaultEventSerializer.
+func OpenFileOutboxStore(path string, serializer *EventSerializer) (*FileOutboxStore, error) {
+	if serializer == nil {
+		serializer = DefaultEventSerializer()
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	s := &FileOutboxStore{path: path, serializer: serializer, file: f}
+	s.size, err = recoverLines(f, func(line []byte) error {
+		var record fileOutboxRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return err
+		}
+		s.apply(record)
+		return nil
+	})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// apply updates the pending envelopes with the given record.
+func (s *FileOutboxStore) apply(record fileOutboxRecord) {
+	if record.Envelope != nil {
+		s.pending = append(s.pending, *record.Envelope)
+	}
+	if removed := slices.Concat(record.Sent, record.Discarded); len(removed) > 0 {
+		s.pending = slices.DeleteFunc(s.pending, func(env storedEnvelope) bool {
+			return slices.Contains(removed, env.ID)
+		})
+		s.sent++
+	}
+}
+
+// Save appends the envelopes to the outbox file and syncs it.
+func (s *FileOutboxStore) Save(_ context.Context, envelopes []Envelope) error {
+	var data []byte
+	records := make([]fileOutboxRecord, 0, len(envelopes))
+	for _, env := range envelopes {
+		stored, err := encodeEnvelope(env, s.serializer)
+		if err != nil {
+			return err
+		}
+		record := fileOutboxRecord{Envelope: &stored}
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+		records = append(records, record)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.write(data); err != nil {
+		return err
+	}
+	for _, record := range records {
+		s.apply(record)
+	}
+	return nil
+}
+
+// Pending returns up to limit pending envelopes, oldest first.
+func (s *FileOutboxStore) Pending(_ context.Context, limit int) ([]Envelope, error) {
+	s.mu.Lock()
+	stored := slices.Clone(s.pending[:min(limit, len(s.pending))])
+	s.mu.Unlock()
+
+	envelopes := make([]Envelope, len(stored))
+	for i, env := range stored {
+		var err error
+		if envelopes[i], err = env.decode(s.serializer); err != nil {
+			return nil, err
+		}
+	}
+	return envelopes, nil
+}
+
+// MarkSent appends a record marking the envelopes as sent and syncs it.
+// The file is rewritten with the remaining pending envelopes when none are left or enough sent records accumulated.
+func (s *FileOutboxStore) MarkSent(_ context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return s.remove(fileOutboxRecord{Sent: ids})
+}
+
+// Discard appends a record dropping the envelopes without sending them and syncs it.
+// The command bus calls it for the events of a command whose transaction failed.
+func (s *FileOutboxStore) Discard(_ context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return s.remove(fileOutboxRecord{Discarded: ids})
+}
+
+// remove appends a record removing envelopes from the pending ones and applies it.
+// The file is rewritten with the remaining pending envelopes when none are left or enough records accumulated.
+func (s *FileOutboxStore) remove(record fileOutboxRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.write(append(line, '\n')); err != nil {
+		return err
+	}
+	s.apply(record)
+	if len(s.pending) == 0 || s.sent >= fileOutboxCompaction {
+		return s.compact()
+	}
+	return nil
+}
+
+// write appends data to the outbox file. It must be called with mu held.
+func (s *FileOutboxStore) write(data []byte) error {
+	if s.file == nil {
+		return os.ErrClosed
+	}
+	var err error
+	s.size, err = appendLines(s.file, s.size, data, true)
+	return err
+}
+
+// compact rewrites the outbox file with only the pending envelopes. It must be called with mu held.
+func (s *FileOutboxStore) compact() error {
+	var data []byte
+	for i := range s.pending {
+		line, err := json.Marshal(fileOutboxRecord{Envelope: &s.pending[i]})
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+	if err := replaceFile(s.path, data); err != nil {
+		return err
+	}
+	// The old file is no longer linked, it must not be written to even if the new one cannot be opened
+	s.file.Close()
+	f, err := os.OpenFile(s.path, os.O_RDWR, 0o644)
+	s.file, s.size, s.sent = f, int64(len(data)), 0
+	return err
+}
+
+// Close closes the outbox file. The store cannot be used afterwards.
+func (s *FileOutboxStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
@@ -0,0 +1,78 @@
+package gocqrs
+
+import (
+	"context"
+	"time"
+)
+
+// CommandOutcome describes the result of an asynchronously dispatched command.
+// It is delivered through a Future once all handlers have run or the command failed.
+type CommandOutcome struct {
+	// Command is the command that was dispatched, without its CommandEnvelope
+	Command Command
+	// Events contains the events produced by the handlers that ran, in dispatch order
+	Events []Event
+	// Err is the error that ended the execution, nil if the command succeeded.
+	// Panics inside handlers are reported as a *PanicError.
+	Err error
+	// StartedAt is the time the execution of the command started
+	StartedAt time.Time
+	// Duration is the time the execution of the command took
+	Duration time.Duration
+}
+
+// Future gives access to the outcome of an asynchronously dispatched command.
+// Callers that do not care about the outcome can simply drop it.
+type Future struct {
+	// done is closed once outcome is set
+	done chan struct{}
+	// outcome is the result of the execution, only read after done is closed
+	outcome CommandOutcome
+}
+
+// newFuture creates an unresolved future.
+func newFuture() *Future {
+	return &Future{done: make(chan struct{})}
+}
+
+// resolvedFuture creates a future that is already resolved with the given error,
+// used when the command cannot be dispatched at all.
+func resolvedFuture(c Command, err error) *Future {
+	f := newFuture()
+	f.resolve(CommandOutcome{Command: c, Err: err, StartedAt: time.Now()})
+	return f
+}
+
+// resolve stores the outcome and wakes up all waiters. It must be called exactly once.
+func (f *Future) resolve(outcome CommandOutcome) {
+	f.outcome = outcome
+	close(f.done)
+}
+
+// Done returns a channel that is closed once the outcome is available.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the command has finished or the context is done.
+// It returns the outcome together with its error, or the context's error if ctx ended first,
+// in which case the command keeps running in the background.
+func (f *Future) Wait(ctx context.Context) (CommandOutcome, error) {
+	select {
+	case <-f.done:
+		return f.outcome, f.outcome.Err
+	case <-ctx.Done():
+		return CommandOutcome{}, ctx.Err()
+	}
+}
+
+// Outcome returns the outcome without blocking.
+// The second return value is false while the command is still running.
+func (f *Future) Outcome() (CommandOutcome, bool) {
+	select {
+	case <-f.done:
+		return f.outcome, true
+	default:
+		return CommandOutcome{}, false
+	}
+}
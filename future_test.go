@@ -0,0 +1,82 @@
+package gocqrs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDispatchAsyncOutcome(t *testing.T) {
+	eventBus := DefaultSyncEventBus()
+	Subscribe(eventBus, func(ctx context.Context, e testEvent) error {
+		return nil
+	})
+	commandBus := DefaultCommandBus(eventBus)
+	RegisterCommand(commandBus, func(ctx context.Context, c testCommand) ([]Event, error) {
+		return []Event{testEvent{Name: c.Name}}, nil
+	})
+
+	future := commandBus.DispatchAsync(context.Background(), testCommand{Name: "async"})
+	outcome, err := future.Wait(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(outcome.Events) != 1 || outcome.Events[0].(testEvent).Name != "async" {
+		t.Errorf("Expected the produced event in the outcome, got %v", outcome.Events)
+	}
+	if outcome.StartedAt.IsZero() {
+		t.Error("Expected the start time to be set")
+	}
+	if _, ok := future.Outcome(); !ok {
+		t.Error("Expected the outcome to be available after Wait")
+	}
+}
+
+func TestDispatchAsyncErrors(t *testing.T) {
+	commandBus := DefaultCommandBus(DefaultSyncEventBus())
+
+	if _, err := commandBus.DispatchAsync(context.Background(), testCommand{}).Wait(context.Background()); !errors.Is(err, ErrNoHandler) {
+		t.Errorf("Expected ErrNoHandler, got %v", err)
+	}
+
+	handlerErr := errors.New("boom")
+	RegisterCommand(commandBus, func(ctx context.Context, c testCommand) ([]Event, error) {
+		return nil, handlerErr
+	})
+	if _, err := commandBus.DispatchAsync(context.Background(), testCommand{}).Wait(context.Background()); !errors.Is(err, handlerErr) {
+		t.Errorf("Expected the handler error, got %v", err)
+	}
+}
+
+func TestDispatchAsyncRecoversPanics(t *testing.T) {
+	commandBus := DefaultCommandBus(DefaultSyncEventBus())
+	RegisterCommand(commandBus, func(ctx context.Context, c testCommand) ([]Event, error) {
+		panic("handler exploded")
+	})
+
+	_, err := commandBus.DispatchAsync(context.Background(), testCommand{}).Wait(context.Background())
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) {
+		t.Fatalf("Expected a PanicError, got %v", err)
+	}
+	if panicErr.Value != "handler exploded" || len(panicErr.Stack) == 0 {
+		t.Errorf("Expected the panic value and a stack trace, got %v", panicErr.Value)
+	}
+}
+
+func TestFutureWaitHonoursContext(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	commandBus := DefaultCommandBus(DefaultSyncEventBus())
+	RegisterCommand(commandBus, func(ctx context.Context, c testCommand) ([]Event, error) {
+		<-release
+		return nil, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := commandBus.DispatchAsync(context.Background(), testCommand{}).Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+}
@@ -1,3 +1,5 @@
 module github.com/avanboxel/gocqrs
 
 go 1.24
+
+require github.com/mattn/go-sqlite3 v1.14.33
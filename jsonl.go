@@ -0,0 +1,106 @@
+package gocqrs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ErrCorruptFile is returned when a file written by one of the file-based stores cannot be read back.
+// A damaged last record is expected after a crash and repaired silently, damage before it is reported.
+var ErrCorruptFile = errors.New("gocqrs: corrupt file")
+
+// recoverLines reads the newline-delimited records of f and passes each of them to apply.
+// A torn trailing record, left behind by a crash during a write, is truncated from the file.
+// If apply fails for any record but the last one, an error wrapping ErrCorruptFile is returned.
+// Returns the size of the valid part of the file, which is positioned at its end.
+func recoverLines(f *os.File, apply func(line []byte) error) (int64, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return 0, err
+	}
+	valid := 0
+	for valid < len(data) {
+		end := bytes.IndexByte(data[valid:], '\n')
+		if end < 0 {
+			break
+		}
+		if err := apply(data[valid : valid+end]); err != nil {
+			if valid+end+1 == len(data) {
+				break
+			}
+			return 0, fmt.Errorf("%w: %s at offset %d: %w", ErrCorruptFile, f.Name(), valid, err)
+		}
+		valid += end + 1
+	}
+	if valid < len(data) {
+		if err := f.Truncate(int64(valid)); err != nil {
+			return 0, err
+		}
+		if err := f.Sync(); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := f.Seek(int64(valid), io.SeekStart); err != nil {
+		return 0, err
+	}
+	return int64(valid), nil
+}
+
+// appendLines writes data at the given size of f, which must be its current end, and optionally syncs it.
+// On failure the file is truncated back to size, so a partial write does not leave a torn record
+// in front of later ones. Returns the new size of the file.
+func appendLines(f *os.File, size int64, data []byte, sync bool) (int64, error) {
+	n, err := f.WriteAt(data, size)
+	if err == nil && sync {
+		err = f.Sync()
+	}
+	if err != nil {
+		if n > 0 {
+			_ = f.Truncate(size)
+		}
+		return size, err
+	}
+	return size + int64(n), nil
+}
+
+// replaceFile atomically replaces the file at path with data by writing a temporary file and renaming it.
+// The directory is synced afterwards so the rename survives a crash.
+func replaceFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir syncs the directory at path, making created, renamed and removed entries durable.
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
@@ -0,0 +1,88 @@
+package gocqrs
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// MemoryEventStore is an EventStore that keeps all events in memory.
+// It is meant for tests and prototypes, the events are lost when the process exits.
+type MemoryEventStore struct {
+	// mu guards events and streams
+	mu sync.RWMutex
+	// events holds all recorded events in the order of their global position
+	events []RecordedEvent
+	// streams maps stream IDs to the indexes of their events in events, in version order
+	streams map[string][]int
+}
+
+// NewMemoryEventStore creates an empty in-memory event store.
+func NewMemoryEventStore() *MemoryEventStore {
+	return &MemoryEventStore{streams: make(map[string][]int)}
+}
+
+// Append adds the envelopes to the end of the stream if it is at the expected version.
+func (s *MemoryEventStore) Append(ctx context.Context, streamID string, expectedVersion int64, envelopes ...Envelope) ([]RecordedEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stream := s.streams[streamID]
+	if err := checkVersion(streamID, expectedVersion, int64(len(stream))); err != nil {
+		return nil, err
+	}
+	recorded := recordEnvelopes(ctx, streamID, int64(len(stream)), int64(len(s.events)), envelopes)
+	for _, event := range recorded {
+		stream = append(stream, len(s.events))
+		s.events = append(s.events, event)
+	}
+	s.streams[streamID] = stream
+	return recorded, nil
+}
+
+// ReadStreamForward returns up to limit events of the stream starting at fromVersion, oldest first.
+func (s *MemoryEventStore) ReadStreamForward(ctx context.Context, streamID string, fromVersion int64, limit int) ([]RecordedEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stream := s.streams[streamID]
+	var events []RecordedEvent
+	for i := max(fromVersion-1, 0); i < int64(len(stream)) && (limit <= 0 || len(events) < limit); i++ {
+		events = append(events, s.events[stream[i]])
+	}
+	return events, nil
+}
+
+// ReadStreamBackward returns up to limit events of the stream starting at fromVersion, newest first.
+func (s *MemoryEventStore) ReadStreamBackward(ctx context.Context, streamID string, fromVersion int64, limit int) ([]RecordedEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stream := s.streams[streamID]
+	var events []RecordedEvent
+	for i := min(fromVersion, int64(len(stream))) - 1; i >= 0 && (limit <= 0 || len(events) < limit); i-- {
+		events = append(events, s.events[stream[i]])
+	}
+	return events, nil
+}
+
+// ReadAll returns up to limit events of all streams starting at the global position fromPosition.
+func (s *MemoryEventStore) ReadAll(ctx context.Context, fromPosition int64, limit int) ([]RecordedEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	start := min(max(fromPosition-1, 0), int64(len(s.events)))
+	end := int64(len(s.events))
+	if limit > 0 {
+		end = min(end, start+int64(limit))
+	}
+	return slices.Clone(s.events[start:end]), nil
+}
@@ -0,0 +1,80 @@
+package gocqrs
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// messageType returns the type used as registry key for the given command or query.
+// Pointers are dereferenced so that RegisterCommand{} and &RegisterCommand{} share the same handlers.
+// Returns ErrInvalidType for nil values and for types without a name, such as anonymous structs.
+func messageType(kind string, v any) (reflect.Type, error) {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return nil, fmt.Errorf("%w: %s is nil", ErrInvalidType, kind)
+	}
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Name() == "" {
+		return nil, fmt.Errorf("%w: %s type %s is not a named type", ErrInvalidType, kind, t)
+	}
+	return t, nil
+}
+
+// isPointer reports whether a command or query was passed as a pointer.
+func isPointer(v any) bool {
+	return reflect.ValueOf(v).Kind() == reflect.Pointer
+}
+
+// messageForm converts a command or query to the form its handler was registered with, value or pointer.
+// Messages already in that form are passed unchanged, so a handler registered with a pointer receives the caller's
+// pointer and can write results back into it. A value sent to such a handler is passed as a pointer to a copy.
+// Returns ErrInvalidType for a nil pointer sent to a handler registered with a value.
+func messageForm(kind string, v any, pointer bool) (any, error) {
+	rv := reflect.ValueOf(v)
+	switch {
+	case (rv.Kind() == reflect.Pointer) == pointer:
+		return v, nil
+	case pointer:
+		ptr := reflect.New(rv.Type())
+		ptr.Elem().Set(rv)
+		return ptr.Interface(), nil
+	case rv.IsNil():
+		return nil, fmt.Errorf("%w: %s is a nil %s", ErrInvalidType, kind, rv.Type())
+	}
+	return rv.Elem().Interface(), nil
+}
+
+// typeName returns a readable, package qualified name for a registry key.
+// The full import path is used so that types from different packages with the same name are told apart.
+func typeName(t reflect.Type) string {
+	if t.PkgPath() == "" {
+		return t.Name()
+	}
+	return t.PkgPath() + "." + t.Name()
+}
+
+// convertMessage converts a command or query to T, accepting both the value and the pointer form of T.
+// This mirrors the normalization done by messageType, where both forms map to the same handlers.
+func convertMessage[T any](v any) (T, bool) {
+	if typed, ok := v.(T); ok {
+		return typed, true
+	}
+
+	var zero T
+	target := reflect.TypeOf(&zero).Elem()
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return zero, false
+	}
+	switch {
+	case rv.Kind() == reflect.Pointer && !rv.IsNil() && rv.Type().Elem() == target:
+		return rv.Elem().Interface().(T), true
+	case target.Kind() == reflect.Pointer && target.Elem() == rv.Type():
+		ptr := reflect.New(rv.Type())
+		ptr.Elem().Set(rv)
+		return ptr.Interface().(T), true
+	}
+	return zero, false
+}
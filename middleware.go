@@ -0,0 +1,59 @@
+package gocqrs
+
+import "context"
+
+// CommandHandlerFunc defines a function type that processes a command within a context.
+// It is the unit that command middleware wraps: the innermost CommandHandlerFunc
+// runs the registered handlers and dispatches their events.
+type CommandHandlerFunc func(ctx context.Context, c Command) error
+
+// CommandMiddleware wraps a CommandHandlerFunc with cross-cutting behavior,
+// such as logging, validation, authorization, transactions or metrics.
+// A middleware can short-circuit the pipeline by returning an error without calling next.
+type CommandMiddleware func(next CommandHandlerFunc) CommandHandlerFunc
+
+// chainCommandMiddleware builds the command pipeline around the given handler function.
+// Middleware groups are applied in order and the first middleware of the first group is the outermost one.
+func chainCommandMiddleware(h CommandHandlerFunc, groups ...[]CommandMiddleware) CommandHandlerFunc {
+	for g := len(groups) - 1; g >= 0; g-- {
+		for i := len(groups[g]) - 1; i >= 0; i-- {
+			h = groups[g][i](h)
+		}
+	}
+	return h
+}
+
+// QueryHandlerFunc defines a function type that processes a query within a context.
+// It is the unit that query middleware wraps: the innermost QueryHandlerFunc calls the registered handler.
+type QueryHandlerFunc func(ctx context.Context, q Query) (QueryResult, error)
+
+// QueryMiddleware wraps a QueryHandlerFunc with cross-cutting behavior,
+// such as caching, timing, authorization or result shaping.
+// A middleware can inspect the query, short-circuit by returning a result without calling next,
+// or post-process the result returned by next.
+type QueryMiddleware func(next QueryHandlerFunc) QueryHandlerFunc
+
+// chainQueryMiddleware builds the query pipeline around the given handler function.
+// Middleware groups are applied in order and the first middleware of the first group is the outermost one.
+func chainQueryMiddleware(h QueryHandlerFunc, groups ...[]QueryMiddleware) QueryHandlerFunc {
+	for g := len(groups) - 1; g >= 0; g-- {
+		for i := len(groups[g]) - 1; i >= 0; i-- {
+			h = groups[g][i](h)
+		}
+	}
+	return h
+}
+
+// EventInterceptor wraps the invocation of a single event subscriber with cross-cutting behavior,
+// such as retries, logging or tracing.
+// The subscriber identifies the wrapped handler and the event type it was registered for.
+type EventInterceptor func(sub Subscriber, next ContextEventHandler) ContextEventHandler
+
+// chainEventInterceptors wraps the handler of a subscriber with the given interceptors.
+// The first interceptor is the outermost one.
+func chainEventInterceptors(sub Subscriber, h ContextEventHandler, interceptors []EventInterceptor) ContextEventHandler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		h = interceptors[i](sub, h)
+	}
+	return h
+}
@@ -0,0 +1,181 @@
+package gocqrs
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCommandMiddlewareOrder(t *testing.T) {
+	var calls []string
+	record := func(name string) CommandMiddleware {
+		return func(next CommandHandlerFunc) CommandHandlerFunc {
+			return func(ctx context.Context, c Command) error {
+				calls = append(calls, name+":before")
+				err := next(ctx, c)
+				calls = append(calls, name+":after")
+				return err
+			}
+		}
+	}
+
+	commandBus := DefaultCommandBus(DefaultSyncEventBus())
+	RegisterCommand(commandBus, func(ctx context.Context, c testCommand) ([]Event, error) {
+		calls = append(calls, "handler")
+		return nil, nil
+	})
+	commandBus.UseFor(testCommand{}, record("typed"))
+	commandBus.Use(record("first"), record("second"))
+
+	if err := commandBus.TryExecute(testCommand{}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := []string{
+		"first:before", "second:before", "typed:before",
+		"handler",
+		"typed:after", "second:after", "first:after",
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected calls %v, got %v", expected, calls)
+	}
+}
+
+func TestCommandMiddlewareShortCircuit(t *testing.T) {
+	var handled bool
+	commandBus := DefaultCommandBus(DefaultSyncEventBus())
+	RegisterCommand(commandBus, func(ctx context.Context, c testCommand) ([]Event, error) {
+		handled = true
+		return nil, nil
+	})
+
+	errUnauthorized := errors.New("unauthorized")
+	commandBus.Use(func(next CommandHandlerFunc) CommandHandlerFunc {
+		return func(ctx context.Context, c Command) error {
+			if c.(testCommand).Name == "" {
+				return errUnauthorized
+			}
+			return next(ctx, c)
+		}
+	})
+
+	if err := commandBus.TryExecute(testCommand{}); !errors.Is(err, errUnauthorized) {
+		t.Errorf("Expected errUnauthorized, got %v", err)
+	}
+	if handled {
+		t.Error("Expected the handler not to run")
+	}
+
+	if err := commandBus.TryExecute(testCommand{Name: "admin"}); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if !handled {
+		t.Error("Expected the handler to run")
+	}
+}
+
+func TestQueryMiddlewareCachesAndShapesResults(t *testing.T) {
+	var calls int
+	queryBus := DefaultQueryBus()
+	RegisterQuery(queryBus, func(ctx context.Context, q testQuery) (int, error) {
+		calls++
+		return q.ID * 2, nil
+	})
+
+	cache := make(map[testQuery]QueryResult)
+	queryBus.Use(func(next QueryHandlerFunc) QueryHandlerFunc {
+		return func(ctx context.Context, q Query) (QueryResult, error) {
+			if result, ok := cache[q.(testQuery)]; ok {
+				return result, nil
+			}
+			result, err := next(ctx, q)
+			if err == nil {
+				cache[q.(testQuery)] = result
+			}
+			return result, err
+		}
+	})
+	queryBus.UseFor(testQuery{}, func(next QueryHandlerFunc) QueryHandlerFunc {
+		return func(ctx context.Context, q Query) (QueryResult, error) {
+			result, err := next(ctx, q)
+			result.Payload = result.Payload.(int) + 1
+			return result, err
+		}
+	})
+
+	for i := 0; i < 3; i++ {
+		result, err := Ask[int](context.Background(), queryBus, testQuery{ID: 10})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if result != 21 {
+			t.Errorf("Expected 21, got %d", result)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected the handler to be called once, got %d", calls)
+	}
+}
+
+func TestEventInterceptorRetriesSubscriber(t *testing.T) {
+	eventBus := DefaultSyncEventBus()
+
+	var attempts int
+	eventBus.RegisterContext("TestEvent", func(ctx context.Context, e Event) error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("temporary failure")
+		}
+		return nil
+	})
+
+	var seen []Subscriber
+	eventBus.Use(func(sub Subscriber, next ContextEventHandler) ContextEventHandler {
+		return func(ctx context.Context, e Event) error {
+			seen = append(seen, sub)
+			var err error
+			for i := 0; i < 3; i++ {
+				if err = next(ctx, e); err == nil {
+					return nil
+				}
+			}
+			return err
+		}
+	})
+
+	if err := eventBus.TryDispatch(testEvent{}); err != nil {
+		t.Fatalf("Expected the retries to succeed, got %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts)
+	}
+	if len(seen) != 1 || seen[0].EventType != "TestEvent" || seen[0].ID == 0 || seen[0].Name == "" {
+		t.Errorf("Expected the interceptor to see the subscriber, got %+v", seen)
+	}
+}
+
+func TestEventInterceptorAsync(t *testing.T) {
+	eventBus := DefaultAsyncEventBus()
+
+	handled := make(chan struct{})
+	eventBus.Register("TestEvent", func(e Event) {
+		close(handled)
+	})
+
+	intercepted := make(chan Subscriber, 1)
+	eventBus.Use(func(sub Subscriber, next ContextEventHandler) ContextEventHandler {
+		return func(ctx context.Context, e Event) error {
+			intercepted <- sub
+			return next(ctx, e)
+		}
+	})
+
+	eventBus.Dispatch(testEvent{})
+
+	sub := <-intercepted
+	<-handled
+	if sub.EventType != "TestEvent" {
+		t.Errorf("Expected event type TestEvent, got %s", sub.EventType)
+	}
+}
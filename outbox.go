@@ -0,0 +1,252 @@
+package gocqrs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// OutboxStore durably stores events until an OutboxRelay has published them to an event bus.
+// Implementations must be safe for concurrent use.
+type OutboxStore interface {
+	// Save stores the given envelopes as pending.
+	// In unit-of-work mode it is called with the context of the command's transaction before it is committed,
+	// stores sharing a database with the handlers should write through TransactionFromContext so the events
+	// are only stored if the transaction commits.
+	Save(ctx context.Context, envelopes []Envelope) error
+
+	// Pending returns up to limit pending envelopes, oldest first.
+	Pending(ctx context.Context, limit int) ([]Envelope, error)
+
+	// MarkSent removes the envelopes with the given IDs from the pending envelopes.
+	// Unknown IDs are ignored.
+	MarkSent(ctx context.Context, ids ...string) error
+}
+
+// OutboxDiscarder is implemented by outbox stores that cannot take part in the transaction of a command.
+// In unit-of-work mode the command bus discards the envelopes it saved when the transaction is rolled back
+// or fails to commit, so the events of a command that did not take effect are never relayed.
+type OutboxDiscarder interface {
+	// Discard removes the envelopes with the given IDs from the pending envelopes without sending them.
+	// Unknown IDs are ignored.
+	Discard(ctx context.Context, ids ...string) error
+}
+
+// SetOutbox sets the outbox the events collected from the handlers are saved to instead of being dispatched.
+// An OutboxRelay publishes them to the event bus afterwards, so events survive a crash after the handlers ran.
+// Failing to save the events fails the command. Passing nil dispatches the events directly again.
+func (d *defaultCommandBus) SetOutbox(store OutboxStore) {
+	d.update(func(r *commandRegistry) {
+		r.outbox = store
+	})
+}
+
+// OutboxRelayConfig configures an OutboxRelay.
+// Zero values are replaced by the defaults of DefaultOutboxRelayConfig.
+type OutboxRelayConfig struct {
+	// PollInterval is the time between two checks for pending events
+	PollInterval time.Duration
+	// BatchSize is the maximum number of pending events read from the store at once
+	BatchSize int
+	// ErrorHook receives failed relay passes, nil to write them to the standard logger
+	ErrorHook ErrorHook
+	// MaxAttempts is the number of failed dispatches after which the relay gives up on an event, so the events
+	// after it are relayed again. Zero or less retries a failing event forever, holding back the whole outbox.
+	MaxAttempts int
+	// DeadLetterHook receives the events the relay gave up on together with their last error, before they are
+	// removed from the outbox. Without a hook they are passed to ErrorHook and dropped.
+	DeadLetterHook DeadLetterHook
+}
+
+// DeadLetterHook receives an event the outbox relay gave up on after OutboxRelayConfig.MaxAttempts failed dispatches,
+// for example to store it for manual inspection.
+type DeadLetterHook func(ctx context.Context, env Envelope, err error)
+
+// DefaultOutboxRelayConfig returns the configuration used for zero values of OutboxRelayConfig.
+// It checks for pending events every 500 milliseconds in batches of 100 and retries failing events forever.
+func DefaultOutboxRelayConfig() OutboxRelayConfig {
+	return OutboxRelayConfig{
+		PollInterval: 500 * time.Millisecond,
+		BatchSize:    100,
+	}
+}
+
+// OutboxRelay publishes the pending events of an outbox to an event bus and marks them as sent.
+// Delivery is at least once: an event whose dispatch fails, or that was dispatched just before a crash,
+// is dispatched again later, so subscribers should be idempotent. Events are published in outbox order,
+// a failing event holds back the events after it until it can be dispatched or the relay gives up on it
+// after OutboxRelayConfig.MaxAttempts.
+// The relay waits for the subscribers of every event, also on an asynchronous event bus created by this package,
+// so an event is only marked as sent once all of them succeeded.
+type OutboxRelay struct {
+	// store is the outbox the events are read from
+	store OutboxStore
+	// dispatch delivers an event to the subscribers of the event bus and returns their failures
+	dispatch func(ctx context.Context, env Envelope) error
+	// config holds the relay configuration with defaults applied
+	config OutboxRelayConfig
+	// relaying serializes relay passes and guards attempts
+	relaying sync.Mutex
+	// attempts counts the failed dispatches of events that are still pending, by event ID
+	attempts map[string]int
+	// mu guards stop and done
+	mu sync.Mutex
+	// stop is closed to ask the relay goroutine to exit, nil while it is not started
+	stop chan struct{}
+	// done is closed once the relay goroutine exited
+	done chan struct{}
+}
+
+// envelopeDeliverer is implemented by event buses that can dispatch an envelope and wait for its subscribers
+// even if they normally run them asynchronously.
+type envelopeDeliverer interface {
+	deliverEnvelope(ctx context.Context, env Envelope) error
+}
+
+// NewOutboxRelay creates a relay publishing the events of the store to the bus.
+// The event buses of this package run the subscribers of relayed events on the relay's goroutine, even in
+// asynchronous mode, so their failures are seen by the relay. Other EventBus implementations must only return
+// from DispatchEnvelope once the subscribers ran, otherwise events are marked as sent before they are delivered.
+// The relay does nothing until Start is called or RelayPending is called directly.
+func NewOutboxRelay(store OutboxStore, bus EventBus, config OutboxRelayConfig) *OutboxRelay {
+	defaults := DefaultOutboxRelayConfig()
+	if config.PollInterval <= 0 {
+		config.PollInterval = defaults.PollInterval
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+	dispatch := bus.DispatchEnvelope
+	if deliverer, ok := bus.(envelopeDeliverer); ok {
+		dispatch = deliverer.deliverEnvelope
+	}
+	return &OutboxRelay{store: store, dispatch: dispatch, config: config, attempts: make(map[string]int)}
+}
+
+// Start starts a goroutine that relays pending events every poll interval until Shutdown is called.
+// Calling Start while the relay is running has no effect.
+func (r *OutboxRelay) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stop != nil {
+		return
+	}
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+	go r.run(r.stop, r.done)
+}
+
+// run relays pending events every poll interval until stop is closed.
+func (r *OutboxRelay) run(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(r.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			ctx := context.Background()
+			if _, err := r.RelayPending(ctx); err != nil {
+				r.reportError(ctx, err)
+			}
+		}
+	}
+}
+
+// reportError passes a failed relay pass to the error hook, or logs it without a hook.
+func (r *OutboxRelay) reportError(ctx context.Context, err error) {
+	if r.config.ErrorHook != nil {
+		r.config.ErrorHook(ctx, err)
+		return
+	}
+	logError(ctx, err)
+}
+
+// RelayPending publishes all pending events and marks them as sent, returning the number of events sent.
+// It stops at the first event that cannot be dispatched, leaving it and the events after it pending,
+// unless the event reached MaxAttempts: it is then passed to the dead letter hook and removed from the outbox.
+func (r *OutboxRelay) RelayPending(ctx context.Context) (int, error) {
+	r.relaying.Lock()
+	defer r.relaying.Unlock()
+
+	sent := 0
+	for {
+		envelopes, err := r.store.Pending(ctx, r.config.BatchSize)
+		if err != nil {
+			return sent, fmt.Errorf("gocqrs: read outbox: %w", err)
+		}
+		if len(envelopes) == 0 {
+			return sent, nil
+		}
+		var ids []string
+		var dispatchErr error
+		given := 0
+		for _, env := range envelopes {
+			if err := r.dispatch(ctx, env); err != nil {
+				err = fmt.Errorf("gocqrs: relay event %s: %w", env.ID, err)
+				if !r.giveUp(ctx, env, err) {
+					dispatchErr = err
+					break
+				}
+				given++
+			}
+			delete(r.attempts, env.ID)
+			ids = append(ids, env.ID)
+		}
+		if len(ids) > 0 {
+			if err := r.store.MarkSent(ctx, ids...); err != nil {
+				return sent, errors.Join(dispatchErr, fmt.Errorf("gocqrs: mark outbox events sent: %w", err))
+			}
+			sent += len(ids) - given
+		}
+		if dispatchErr != nil || len(envelopes) < r.config.BatchSize {
+			return sent, dispatchErr
+		}
+	}
+}
+
+// giveUp counts a failed dispatch of the envelope and reports whether the relay gives up on it
+// because it reached MaxAttempts. Events given up on are passed to the dead letter hook, or to the error hook
+// without one. It must be called with relaying held.
+func (r *OutboxRelay) giveUp(ctx context.Context, env Envelope, err error) bool {
+	if r.config.MaxAttempts <= 0 {
+		return false
+	}
+	r.attempts[env.ID]++
+	if r.attempts[env.ID] < r.config.MaxAttempts {
+		return false
+	}
+	if r.config.DeadLetterHook != nil {
+		r.config.DeadLetterHook(ctx, env, err)
+	} else {
+		r.reportError(ctx, fmt.Errorf("gocqrs: dropped outbox event after %d attempts: %w", r.config.MaxAttempts, err))
+	}
+	return true
+}
+
+// Shutdown stops the relay goroutine and waits until the current relay pass has finished or ctx is done.
+// Events that are still pending are relayed after the next Start.
+func (r *OutboxRelay) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	stop, done := r.stop, r.done
+	r.stop, r.done = nil, nil
+	r.mu.Unlock()
+	if stop == nil {
+		return nil
+	}
+	close(stop)
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops the relay goroutine like Shutdown, waiting without a deadline.
+func (r *OutboxRelay) Close() error {
+	return r.Shutdown(context.Background())
+}
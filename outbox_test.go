@@ -0,0 +1,302 @@
+package gocqrs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// newTestSerializer creates a serializer for testEvent using the given codec.
+func newTestSerializer(codec Codec) *EventSerializer {
+	types := NewEventTypeRegistry()
+	RegisterEventTypeIn[testEvent](types)
+	return NewEventSerializer(types, codec)
+}
+
+func openTestOutbox(t *testing.T, path string) *FileOutboxStore {
+	t.Helper()
+	store, err := OpenFileOutboxStore(path, newTestSerializer(JSONCodec))
+	if err != nil {
+		t.Fatalf("Expected outbox to open, got %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestOutboxRelay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	store := openTestOutbox(t, path)
+
+	var received []Envelope
+	eventBus := DefaultSyncEventBus()
+	eventBus.RegisterEnvelope("TestEvent", func(ctx context.Context, env Envelope) error {
+		received = append(received, env)
+		return nil
+	})
+	commandBus := DefaultCommandBus(eventBus)
+	commandBus.SetOutbox(store)
+	commandBus.Register(testCommand{}, &testCommandHandler{})
+
+	ctx := WithCorrelationID(context.Background(), "request-1")
+	if err := commandBus.ExecuteContext(ctx, testCommand{Name: "John"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(received) != 0 {
+		t.Fatalf("Expected events to wait in the outbox, got %v", received)
+	}
+
+	reopened := openTestOutbox(t, path)
+	relay := NewOutboxRelay(reopened, eventBus, OutboxRelayConfig{})
+	sent, err := relay.RelayPending(context.Background())
+	if err != nil || sent != 1 {
+		t.Fatalf("Expected 1 event sent, got %d and %v", sent, err)
+	}
+	if len(received) != 1 || received[0].Event != (testEvent{Name: "John"}) || received[0].CorrelationID != "request-1" {
+		t.Errorf("Expected relayed event with its envelope, got %+v", received)
+	}
+
+	if pending, _ := openTestOutbox(t, path).Pending(context.Background(), 10); len(pending) != 0 {
+		t.Errorf("Expected no pending events after relaying, got %v", pending)
+	}
+}
+
+func TestOutboxRelayRetriesFailedEvents(t *testing.T) {
+	store := openTestOutbox(t, filepath.Join(t.TempDir(), "outbox.jsonl"))
+	envelopes := []Envelope{
+		Envelope{Event: testEvent{Name: "first"}}.complete(context.Background()),
+		Envelope{Event: testEvent{Name: "second"}}.complete(context.Background()),
+	}
+	if err := store.Save(context.Background(), envelopes); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	subscriberErr := errors.New("projection unavailable")
+	var attempts []string
+	eventBus := DefaultSyncEventBus()
+	Subscribe(eventBus, func(ctx context.Context, e testEvent) error {
+		attempts = append(attempts, e.Name)
+		if e.Name == "second" && len(attempts) < 3 {
+			return subscriberErr
+		}
+		return nil
+	})
+
+	relay := NewOutboxRelay(store, eventBus, OutboxRelayConfig{})
+	sent, err := relay.RelayPending(context.Background())
+	if !errors.Is(err, subscriberErr) || sent != 1 {
+		t.Errorf("Expected 1 event sent before the failure, got %d and %v", sent, err)
+	}
+	sent, err = relay.RelayPending(context.Background())
+	if err != nil || sent != 1 {
+		t.Errorf("Expected the failed event to be sent again, got %d and %v", sent, err)
+	}
+	if want := []string{"first", "second", "second"}; !slices.Equal(attempts, want) {
+		t.Errorf("Expected attempts %v, got %v", want, attempts)
+	}
+}
+
+func TestOutboxRelayDeadLetter(t *testing.T) {
+	store := openTestOutbox(t, filepath.Join(t.TempDir(), "outbox.jsonl"))
+	envelopes := []Envelope{
+		Envelope{Event: testEvent{Name: "poison"}}.complete(context.Background()),
+		Envelope{Event: testEvent{Name: "second"}}.complete(context.Background()),
+	}
+	if err := store.Save(context.Background(), envelopes); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	subscriberErr := errors.New("malformed event")
+	var delivered []string
+	eventBus := DefaultSyncEventBus()
+	eventBus.SetErrorHook(func(ctx context.Context, err error) {})
+	Subscribe(eventBus, func(ctx context.Context, e testEvent) error {
+		if e.Name == "poison" {
+			return subscriberErr
+		}
+		delivered = append(delivered, e.Name)
+		return nil
+	})
+
+	var deadLetters []Envelope
+	relay := NewOutboxRelay(store, eventBus, OutboxRelayConfig{
+		MaxAttempts: 2,
+		DeadLetterHook: func(ctx context.Context, env Envelope, err error) {
+			if !errors.Is(err, subscriberErr) {
+				t.Errorf("Expected the subscriber failure, got %v", err)
+			}
+			deadLetters = append(deadLetters, env)
+		},
+	})
+	if sent, err := relay.RelayPending(context.Background()); !errors.Is(err, subscriberErr) || sent != 0 {
+		t.Fatalf("Expected the first attempt to fail, got %d and %v", sent, err)
+	}
+	if sent, err := relay.RelayPending(context.Background()); err != nil || sent != 1 {
+		t.Fatalf("Expected the event after the dead letter to be sent, got %d and %v", sent, err)
+	}
+	if len(deadLetters) != 1 || deadLetters[0].ID != envelopes[0].ID {
+		t.Errorf("Expected the poison event as dead letter, got %v", deadLetters)
+	}
+	if want := []string{"second"}; !slices.Equal(delivered, want) {
+		t.Errorf("Expected delivered %v, got %v", want, delivered)
+	}
+	if pending, _ := store.Pending(context.Background(), 10); len(pending) != 0 {
+		t.Errorf("Expected no pending events, got %v", pending)
+	}
+}
+
+func TestOutboxRelayAsyncEventBus(t *testing.T) {
+	store := openTestOutbox(t, filepath.Join(t.TempDir(), "outbox.jsonl"))
+	if err := store.Save(context.Background(), []Envelope{Envelope{Event: testEvent{Name: "John"}}.complete(context.Background())}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	subscriberErr := errors.New("projection unavailable")
+	attempts := 0
+	eventBus := DefaultAsyncEventBus()
+	defer eventBus.Close()
+	eventBus.SetErrorHook(func(ctx context.Context, err error) {})
+	Subscribe(eventBus, func(ctx context.Context, e testEvent) error {
+		attempts++
+		if attempts == 1 {
+			return subscriberErr
+		}
+		return nil
+	})
+
+	// The relay must see the failure of the asynchronous subscriber and keep the event pending
+	relay := NewOutboxRelay(store, eventBus, OutboxRelayConfig{})
+	if sent, err := relay.RelayPending(context.Background()); !errors.Is(err, subscriberErr) || sent != 0 {
+		t.Fatalf("Expected the subscriber failure, got %d and %v", sent, err)
+	}
+	if pending, _ := store.Pending(context.Background(), 10); len(pending) != 1 {
+		t.Fatalf("Expected the event to stay pending, got %d", len(pending))
+	}
+	if sent, err := relay.RelayPending(context.Background()); err != nil || sent != 1 || attempts != 2 {
+		t.Errorf("Expected the event to be delivered on the second pass, got %d, %v and %d attempts", sent, err, attempts)
+	}
+}
+
+func TestOutboxRelayStart(t *testing.T) {
+	store := openTestOutbox(t, filepath.Join(t.TempDir(), "outbox.jsonl"))
+	received := make(chan Event, 1)
+	eventBus := DefaultSyncEventBus()
+	eventBus.Register("TestEvent", func(e Event) {
+		received <- e
+	})
+	commandBus := DefaultCommandBus(eventBus)
+	commandBus.SetOutbox(store)
+	commandBus.Register(testCommand{}, &testCommandHandler{})
+
+	relay := NewOutboxRelay(store, eventBus, OutboxRelayConfig{PollInterval: time.Millisecond})
+	relay.Start()
+	defer relay.Close()
+	commandBus.Execute(testCommand{Name: "John"})
+
+	select {
+	case e := <-received:
+		if e != (testEvent{Name: "John"}) {
+			t.Errorf("Expected relayed event, got %v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the relay to publish the event")
+	}
+}
+
+func TestOutboxUnitOfWork(t *testing.T) {
+	store := openTestOutbox(t, filepath.Join(t.TempDir(), "outbox.jsonl"))
+	commandBus := DefaultCommandBus(DefaultSyncEventBus())
+	commandBus.SetOutbox(store)
+	commandBus.SetUnitOfWork(true)
+	commandBus.Register(testCommand{}, &testCommandHandler{})
+	commandBus.Register(testCommand{}, &failingCommandHandler{err: errors.New("failed")})
+
+	if err := commandBus.TryExecute(testCommand{}); !errors.Is(err, ErrHandlerFailed) {
+		t.Errorf("Expected handler error, got %v", err)
+	}
+	if pending, _ := store.Pending(context.Background(), 10); len(pending) != 0 {
+		t.Errorf("Expected no events saved for a failed unit of work, got %v", pending)
+	}
+}
+
+func TestOutboxUnitOfWorkCommitFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	store := openTestOutbox(t, path)
+	var log []string
+	commitErr := errors.New("serialization failure")
+	commandBus := newUnitOfWorkBus(&log, commitErr)
+	commandBus.SetOutbox(store)
+	commandBus.Register(testCommand{}, &testCommandHandler{})
+
+	if err := commandBus.TryExecute(testCommand{Name: "John"}); !errors.Is(err, commitErr) {
+		t.Fatalf("Expected commit error, got %v", err)
+	}
+
+	// The discard record must survive reopening the outbox
+	relay := NewOutboxRelay(openTestOutbox(t, path), DefaultSyncEventBus(), OutboxRelayConfig{})
+	if sent, err := relay.RelayPending(context.Background()); err != nil || sent != 0 {
+		t.Errorf("Expected nothing relayed for a failed commit, got %d and %v", sent, err)
+	}
+	if want := []string{"begin", "commit"}; !slices.Equal(log, want) {
+		t.Errorf("Expected %v, got %v", want, log)
+	}
+}
+
+func TestOutboxDiscardsEventsRejectedByEventStore(t *testing.T) {
+	types := NewEventTypeRegistry()
+	RegisterEventTypeIn[accountOpened](types)
+	store, err := OpenFileOutboxStore(filepath.Join(t.TempDir(), "outbox.jsonl"), NewEventSerializer(types, nil))
+	if err != nil {
+		t.Fatalf("Expected outbox to open, got %v", err)
+	}
+	defer store.Close()
+	commandBus := DefaultCommandBus(DefaultSyncEventBus())
+	commandBus.SetOutbox(store)
+	commandBus.SetEventStore(NewMemoryEventStore())
+	RegisterCommand(commandBus, func(ctx context.Context, c openAccount) ([]Event, error) {
+		return []Event{accountOpened{AccountID: c.AccountID, Version: 1}}, nil
+	})
+
+	if err := commandBus.TryExecute(openAccount{AccountID: "acc-1"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := commandBus.TryExecute(openAccount{AccountID: "acc-1"}); !errors.Is(err, ErrConcurrencyConflict) {
+		t.Fatalf("Expected concurrency conflict, got %v", err)
+	}
+	if pending, _ := store.Pending(context.Background(), 10); len(pending) != 1 {
+		t.Errorf("Expected only the stored event to stay pending, got %d", len(pending))
+	}
+}
+
+func TestFileOutboxStoreTruncatesTornWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	store := openTestOutbox(t, path)
+	env := Envelope{Event: testEvent{Name: "kept"}}.complete(context.Background())
+	if err := store.Save(context.Background(), []Envelope{env}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	store.Close()
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"envelope":{"id":"torn","type":"Test`)
+	f.Close()
+
+	reopened := openTestOutbox(t, path)
+	pending, err := reopened.Pending(context.Background(), 10)
+	if err != nil || len(pending) != 1 || pending[0].ID != env.ID {
+		t.Fatalf("Expected only the complete envelope, got %v and %v", pending, err)
+	}
+	if err := reopened.Save(context.Background(), []Envelope{Envelope{Event: testEvent{}}.complete(context.Background())}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	reopened.Close()
+	if pending, err := openTestOutbox(t, path).Pending(context.Background(), 10); err != nil || len(pending) != 2 {
+		t.Errorf("Expected 2 pending envelopes after appending, got %d and %v", len(pending), err)
+	}
+}
@@ -1,6 +1,12 @@
 package gocqrs
 
-import "reflect"
+import (
+	"context"
+	"maps"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
 
 // Query represents any query object that can be handled by a QueryHandler.
 // Queries are read-only operations that retrieve data from the system.
@@ -13,7 +19,7 @@ type QueryResult struct {
 	// Payload contains the actual query result data.
 	// The type depends on the specific query being executed.
 	Payload any
-	
+
 	// Success indicates whether the query was executed successfully.
 	// When false, Payload may contain error information.
 	Success bool
@@ -28,6 +34,17 @@ type QueryHandler interface {
 	Handle(q Query) QueryResult
 }
 
+// ContextQueryHandler is an optional interface a QueryHandler can implement to receive the context.
+// When a registered handler implements it, the query bus calls HandleContext instead of Handle,
+// passing the context given to AskContext.
+type ContextQueryHandler interface {
+	QueryHandler
+
+	// HandleContext processes the given query within the given context.
+	// A non-nil error is returned to the caller of AskContext wrapped with ErrHandlerFailed.
+	HandleContext(ctx context.Context, q Query) (QueryResult, error)
+}
+
 // QueryBus defines the interface for a query bus that handles read operations.
 // It provides methods to execute queries and register query handlers.
 type QueryBus interface {
@@ -35,42 +52,204 @@ type QueryBus interface {
 	// It looks up the registered handler for the query type and delegates execution.
 	// Panics if no handler is registered for the query type.
 	Ask(q Query) QueryResult
-	
+
+	// TryAsk executes a query synchronously like Ask.
+	// Returns ErrNoHandler instead of panicking if no handler is registered for the query type.
+	TryAsk(q Query) (QueryResult, error)
+
+	// AskContext executes a query synchronously like TryAsk within the given context.
+	// Returns the context's error if it is already done before the handler is called.
+	AskContext(ctx context.Context, q Query) (QueryResult, error)
+
 	// Register associates a query type with its corresponding handler.
-	// The query parameter is used to determine the type name for registration.
+	// The query parameter is used to determine the type for registration,
+	// a query and a pointer to it share the same handler.
 	// Only one handler can be registered per query type (last registration wins).
+	// Panics if the query is nil or not of a named type.
 	Register(q Query, qh QueryHandler)
+
+	// TryRegister associates a query type with its corresponding handler like Register.
+	// Returns ErrInvalidType instead of panicking if the query cannot be used for registration.
+	TryRegister(q Query, qh QueryHandler) error
+
+	// Unregister removes the handler registered for the type of the given query.
+	// Queries asked afterwards fail with ErrNoHandler until a new handler is registered.
+	// Queries that already started are allowed to complete.
+	Unregister(q Query)
+}
+
+// queryRegistry holds the handlers and middleware of a query bus.
+// A registry is never modified once published, changes are made on a clone.
+type queryRegistry struct {
+	// handlers maps query types to their corresponding handlers
+	handlers map[reflect.Type]QueryHandler
+	// pointers holds the query types whose handler was registered with a pointer, queries are passed in that form
+	pointers map[reflect.Type]bool
+	// middleware wraps the handling of every query, in registration order
+	middleware []QueryMiddleware
+	// typeMiddleware maps query types to middleware that only wraps queries of that type
+	typeMiddleware map[reflect.Type][]QueryMiddleware
+}
+
+// clone returns a copy of the registry that can be modified without affecting readers of the original.
+// Slices are shared, so they must only be extended with appendCopy.
+func (r *queryRegistry) clone() *queryRegistry {
+	return &queryRegistry{
+		handlers:       maps.Clone(r.handlers),
+		pointers:       maps.Clone(r.pointers),
+		middleware:     r.middleware,
+		typeMiddleware: maps.Clone(r.typeMiddleware),
+	}
 }
 
 // defaultQueryBus is the default implementation of QueryBus.
 // It uses reflection to map query types to their handlers.
+// It is safe for concurrent registration and dispatch.
 type defaultQueryBus struct {
-	// handlers maps query type names to their corresponding handlers
-	handlers map[string]QueryHandler
+	// mu serializes changes to the registry
+	mu sync.Mutex
+	// registry holds the current handlers and middleware and is replaced as a whole on every change
+	registry atomic.Pointer[queryRegistry]
 }
 
 // Ask executes the given query by finding its registered handler.
 // It uses reflection to determine the query type name and looks up the handler.
 // Panics if no handler is registered for the query type.
 func (d *defaultQueryBus) Ask(q Query) QueryResult {
-	qh := d.handlers[reflect.TypeOf(q).Name()]
+	result, err := d.TryAsk(q)
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
+// TryAsk executes the given query by finding its registered handler.
+// Returns ErrNoHandler if no handler is registered for the query type.
+func (d *defaultQueryBus) TryAsk(q Query) (QueryResult, error) {
+	return d.AskContext(context.Background(), q)
+}
+
+// AskContext executes the given query within the given context.
+// The query runs through the middleware pipeline before reaching its handler.
+// Context-aware handlers receive ctx, other handlers are called through Handle.
+func (d *defaultQueryBus) AskContext(ctx context.Context, q Query) (QueryResult, error) {
+	t, err := messageType("query", q)
+	if err != nil {
+		return QueryResult{}, err
+	}
+	registry := d.registry.Load()
+	qh := registry.handlers[t]
 	if qh == nil {
-		panic("no handler registered for query type: " + reflect.TypeOf(q).Name())
+		return QueryResult{}, noHandlerError("query", typeName(t))
+	}
+	next := func(ctx context.Context, q Query) (QueryResult, error) {
+		q, err := messageForm("query", q, registry.pointers[t])
+		if err != nil {
+			return QueryResult{}, err
+		}
+		return invokeQueryHandler(ctx, t, qh, q)
 	}
-	return qh.Handle(q)
+	return chainQueryMiddleware(next, registry.middleware, registry.typeMiddleware[t])(ctx, q)
+}
+
+// Unregister removes the handler for the given query type.
+// Middleware added with UseFor for the query type is kept.
+func (d *defaultQueryBus) Unregister(q Query) {
+	t, err := messageType("query", q)
+	if err != nil {
+		return
+	}
+	d.update(func(r *queryRegistry) {
+		delete(r.handlers, t)
+		delete(r.pointers, t)
+	})
+}
+
+// Use adds middleware that wraps the handling of every query.
+// Global middleware runs before any per-type middleware added with UseFor,
+// and middleware added first is the outermost one.
+func (d *defaultQueryBus) Use(mw ...QueryMiddleware) {
+	d.update(func(r *queryRegistry) {
+		r.middleware = appendCopy(r.middleware, mw...)
+	})
+}
+
+// UseFor adds middleware that only wraps the handling of queries of the given type.
+// It runs after the global middleware, in the order it was added.
+// Panics if the query is nil or not of a named type.
+func (d *defaultQueryBus) UseFor(q Query, mw ...QueryMiddleware) {
+	t, err := messageType("query", q)
+	if err != nil {
+		panic(err)
+	}
+	d.update(func(r *queryRegistry) {
+		r.typeMiddleware[t] = appendCopy(r.typeMiddleware[t], mw...)
+	})
+}
+
+// update applies the given change to a clone of the registry and publishes the clone.
+func (d *defaultQueryBus) update(change func(r *queryRegistry)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	r := d.registry.Load().clone()
+	change(r)
+	d.registry.Store(r)
+}
+
+// invokeQueryHandler calls the handler of the query, preferring HandleContext when it is implemented.
+// Handler errors and recovered panics are wrapped with ErrHandlerFailed.
+func invokeQueryHandler(ctx context.Context, t reflect.Type, qh QueryHandler, q Query) (result QueryResult, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = QueryResult{}, handlerError("query", typeName(t), newPanicError(r))
+		}
+	}()
+	if err := ctx.Err(); err != nil {
+		return QueryResult{}, err
+	}
+	if ch, ok := qh.(ContextQueryHandler); ok {
+		result, err := ch.HandleContext(ctx, q)
+		if err != nil {
+			return result, handlerError("query", typeName(t), err)
+		}
+		return result, nil
+	}
+	return qh.Handle(q), nil
 }
 
 // Register stores a query handler for the given query type.
-// It uses reflection to extract the type name from the query instance.
+// It uses reflection to extract the type from the query instance.
 // If a handler already exists for this query type, it will be replaced.
 func (d *defaultQueryBus) Register(q Query, qh QueryHandler) {
-	d.handlers[reflect.TypeOf(q).Name()] = qh
+	if err := d.TryRegister(q, qh); err != nil {
+		panic(err)
+	}
+}
+
+// TryRegister stores a query handler for the given query type.
+// Pointer queries are registered under the type they point to. The handler receives queries in the form
+// it was registered with, so a handler registered with a pointer can assert the pointer type.
+// Returns ErrInvalidType for nil queries and queries of anonymous types.
+func (d *defaultQueryBus) TryRegister(q Query, qh QueryHandler) error {
+	t, err := messageType("query", q)
+	if err != nil {
+		return err
+	}
+	d.update(func(r *queryRegistry) {
+		r.handlers[t] = qh
+		r.pointers[t] = isPointer(q)
+	})
+	return nil
 }
 
 // DefaultQueryBus creates a new instance of the default query bus implementation.
 // Returns a QueryBus that uses reflection-based handler lookup.
 func DefaultQueryBus() *defaultQueryBus {
-	return &defaultQueryBus{
-		handlers: make(map[string]QueryHandler),
-	}
-}
\ No newline at end of file
+	d := &defaultQueryBus{}
+	d.registry.Store(&queryRegistry{
+		handlers:       make(map[reflect.Type]QueryHandler),
+		pointers:       make(map[reflect.Type]bool),
+		typeMiddleware: make(map[reflect.Type][]QueryMiddleware),
+	})
+	return d
+}
@@ -0,0 +1,81 @@
+package gocqrs
+
+import (
+	"errors"
+	"testing"
+)
+
+type testQuery struct {
+	ID int
+}
+
+type testQueryHandler struct{}
+
+func (h *testQueryHandler) Handle(q Query) QueryResult {
+	return QueryResult{Payload: q.(testQuery).ID * 2, Success: true}
+}
+
+func TestTryAsk(t *testing.T) {
+	queryBus := DefaultQueryBus()
+
+	if _, err := queryBus.TryAsk(testQuery{ID: 1}); !errors.Is(err, ErrNoHandler) {
+		t.Errorf("Expected ErrNoHandler, got %v", err)
+	}
+
+	queryBus.Register(testQuery{}, &testQueryHandler{})
+
+	result, err := queryBus.TryAsk(testQuery{ID: 21})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.Payload != 42 {
+		t.Errorf("Expected payload 42, got %v", result.Payload)
+	}
+}
+
+func TestAskPointerQuery(t *testing.T) {
+	queryBus := DefaultQueryBus()
+	queryBus.Register(testQuery{}, &testQueryHandler{})
+
+	result, err := queryBus.TryAsk(&testQuery{ID: 2})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.Payload != 4 {
+		t.Errorf("Expected payload 4, got %v", result.Payload)
+	}
+	if _, err := queryBus.TryAsk((*testQuery)(nil)); !errors.Is(err, ErrInvalidType) {
+		t.Errorf("Expected ErrInvalidType for a nil pointer query, got %v", err)
+	}
+}
+
+type pointerQueryHandler struct{}
+
+func (h *pointerQueryHandler) Handle(q Query) QueryResult {
+	return QueryResult{Payload: q.(*testQuery).ID * 3, Success: true}
+}
+
+func TestAskPointerRegisteredQuery(t *testing.T) {
+	queryBus := DefaultQueryBus()
+	queryBus.Register(&testQuery{}, &pointerQueryHandler{})
+
+	for _, q := range []Query{&testQuery{ID: 2}, testQuery{ID: 2}} {
+		result, err := queryBus.TryAsk(q)
+		if err != nil {
+			t.Fatalf("Expected no error for %T, got %v", q, err)
+		}
+		if result.Payload != 6 {
+			t.Errorf("Expected payload 6 for %T, got %v", q, result.Payload)
+		}
+	}
+}
+
+func TestUnregisterQuery(t *testing.T) {
+	queryBus := DefaultQueryBus()
+	queryBus.Register(testQuery{}, &testQueryHandler{})
+	queryBus.Unregister(&testQuery{})
+
+	if _, err := queryBus.TryAsk(testQuery{ID: 1}); !errors.Is(err, ErrNoHandler) {
+		t.Errorf("Expected ErrNoHandler after unregistering, got %v", err)
+	}
+}
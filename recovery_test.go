@@ -0,0 +1,118 @@
+package gocqrs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestSyncEventBusIsolatesPanickingSubscriber(t *testing.T) {
+	eventBus := DefaultSyncEventBus()
+
+	var hooked []error
+	eventBus.SetErrorHook(func(ctx context.Context, err error) {
+		hooked = append(hooked, err)
+	})
+
+	var calls int
+	eventBus.Register("TestEvent", func(e Event) {
+		panic("subscriber exploded")
+	})
+	eventBus.Register("TestEvent", func(e Event) {
+		calls++
+	})
+
+	err := eventBus.TryDispatch(testEvent{})
+
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) || len(panicErr.Stack) == 0 {
+		t.Fatalf("Expected a PanicError with stack trace, got %v", err)
+	}
+	var subErr *SubscriberError
+	if !errors.As(err, &subErr) || subErr.Subscriber.ID != 1 {
+		t.Errorf("Expected a SubscriberError for the first subscriber, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected the second subscriber to run, got %d calls", calls)
+	}
+	if len(hooked) != 1 {
+		t.Errorf("Expected the error hook to be called once, got %d", len(hooked))
+	}
+}
+
+func TestAsyncEventBusRecoversPanics(t *testing.T) {
+	eventBus := DefaultAsyncEventBus()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	var mu sync.Mutex
+	var hooked []error
+	eventBus.SetErrorHook(func(ctx context.Context, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		hooked = append(hooked, err)
+		wg.Done()
+	})
+	eventBus.Register("TestEvent", func(e Event) {
+		panic("subscriber exploded")
+	})
+	eventBus.Register("TestEvent", func(e Event) {
+		wg.Done()
+	})
+
+	eventBus.Dispatch(testEvent{})
+	wg.Wait()
+
+	var panicErr *PanicError
+	if len(hooked) != 1 || !errors.As(hooked[0], &panicErr) {
+		t.Errorf("Expected one PanicError in the hook, got %v", hooked)
+	}
+}
+
+func TestCommandBusRecoversPanics(t *testing.T) {
+	commandBus := DefaultCommandBus(DefaultSyncEventBus())
+	commandBus.Register(testCommand{}, CommandHandlerFactory(func() CommandHandler {
+		panic("handler exploded")
+	}))
+
+	err := commandBus.TryExecute(testCommand{})
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) || !errors.Is(err, ErrHandlerFailed) {
+		t.Errorf("Expected a PanicError wrapped with ErrHandlerFailed, got %v", err)
+	}
+
+	hooked := make(chan error, 1)
+	commandBus.SetErrorHook(func(ctx context.Context, err error) {
+		hooked <- err
+	})
+	commandBus.Dispatch(testCommand{})
+	if err := <-hooked; !errors.As(err, &panicErr) {
+		t.Errorf("Expected the hook to receive a PanicError, got %v", err)
+	}
+}
+
+func TestCommandContinuesAfterFailingSubscriber(t *testing.T) {
+	eventBus := DefaultSyncEventBus()
+	var received []string
+	Subscribe(eventBus, func(ctx context.Context, e testEvent) error {
+		if e.Name == "first" {
+			panic("subscriber exploded")
+		}
+		received = append(received, e.Name)
+		return nil
+	})
+	commandBus := DefaultCommandBus(eventBus)
+	RegisterCommand(commandBus, func(ctx context.Context, c testCommand) ([]Event, error) {
+		return []Event{testEvent{Name: "first"}, testEvent{Name: "second"}}, nil
+	})
+
+	err := commandBus.TryExecute(testCommand{})
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) {
+		t.Errorf("Expected the subscriber panic to be reported, got %v", err)
+	}
+	if len(received) != 1 || received[0] != "second" {
+		t.Errorf("Expected the second event to be delivered, got %v", received)
+	}
+}
@@ -0,0 +1,13 @@
+package gocqrs
+
+import "slices"
+
+// The buses keep their handlers and middleware in immutable registries.
+// Every change clones the current registry under a mutex and atomically swaps in the new one,
+// so dispatching only loads a pointer and never takes a lock.
+
+// appendCopy appends the values to s without ever writing to the backing array of s,
+// which may still be read through an older registry.
+func appendCopy[T any](s []T, values ...T) []T {
+	return append(slices.Clip(s), values...)
+}
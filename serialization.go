@@ -0,0 +1,101 @@
+package gocqrs
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// storedEnvelope is the serialized form of an Envelope written by the durable stores.
+type storedEnvelope struct {
+	// ID is the envelope ID
+	ID string `json:"id"`
+	// EventType is the type returned by the event's GetEventType method
+	EventType string `json:"type"`
+	// SchemaVersion is the schema version of the payload, zero for events stored before versions were recorded
+	SchemaVersion int `json:"schemaVersion,omitempty"`
+	// Codec names the codec the event was encoded with, empty for JSON
+	Codec string `json:"codec,omitempty"`
+	// Payload is the event encoded as JSON, embedded as is to keep the stored files readable
+	Payload json.RawMessage `json:"payload,omitempty"`
+	// Data is the event encoded with any other codec
+	Data []byte `json:"data,omitempty"`
+	// Timestamp is the envelope timestamp
+	Timestamp time.Time `json:"timestamp"`
+	// AggregateID is the aggregate the event belongs to
+	AggregateID string `json:"aggregateId,omitempty"`
+	// Version is the aggregate version after the event
+	Version int64 `json:"version,omitempty"`
+	// CorrelationID is the envelope correlation ID
+	CorrelationID string `json:"correlationId,omitempty"`
+	// CausationID is the envelope causation ID
+	CausationID string `json:"causationId,omitempty"`
+	// Metadata holds the envelope metadata
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// encodeEnvelope converts the envelope into its serialized form, encoding the event with the serializer.
+func encodeEnvelope(env Envelope, serializer *EventSerializer) (storedEnvelope, error) {
+	payload, err := serializer.Serialize(env.Event)
+	if err != nil {
+		return storedEnvelope{}, err
+	}
+	stored := storedEnvelope{
+		ID:            env.ID,
+		EventType:     env.Event.GetEventType(),
+		Timestamp:     env.Timestamp,
+		AggregateID:   env.AggregateID,
+		Version:       env.Version,
+		CorrelationID: env.CorrelationID,
+		CausationID:   env.CausationID,
+		Metadata:      env.Metadata,
+		// The payload is encoded from the current Go type, whatever version the envelope claims
+		SchemaVersion: schemaVersion(env.Event),
+	}
+	stored.setPayload(serializer.Codec().Name(), payload)
+	return stored, nil
+}
+
+// setPayload stores the payload encoded with the named codec.
+func (s *storedEnvelope) setPayload(codec string, payload []byte) {
+	if codec == JSONCodec.Name() {
+		s.Codec, s.Payload, s.Data = "", payload, nil
+		return
+	}
+	s.Codec, s.Payload, s.Data = codec, nil, payload
+}
+
+// codec returns the name of the codec the payload was encoded with.
+func (s storedEnvelope) codec() string {
+	if s.Codec == "" {
+		return JSONCodec.Name()
+	}
+	return s.Codec
+}
+
+// payload returns the encoded event, whichever codec it was encoded with.
+func (s storedEnvelope) payload() []byte {
+	if s.Payload != nil {
+		return s.Payload
+	}
+	return s.Data
+}
+
+// decode converts the serialized envelope back into an Envelope, decoding the event with the serializer.
+// Payloads of older schema versions are upcast to the current version of the event type.
+func (s storedEnvelope) decode(serializer *EventSerializer) (Envelope, error) {
+	e, err := serializer.deserializeWith(s.codec(), s.EventType, max(s.SchemaVersion, 1), s.payload())
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{
+		ID:            s.ID,
+		Event:         e,
+		Timestamp:     s.Timestamp,
+		AggregateID:   s.AggregateID,
+		Version:       s.Version,
+		CorrelationID: s.CorrelationID,
+		CausationID:   s.CausationID,
+		Metadata:      s.Metadata,
+		SchemaVersion: schemaVersion(e),
+	}, nil
+}
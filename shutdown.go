@@ -0,0 +1,133 @@
+package gocqrs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrClosed is returned when asynchronous work is dispatched to a bus that is shut down.
+// Futures of commands that were abandoned during shutdown resolve with it as well.
+var ErrClosed = errors.New("gocqrs: bus is shut down")
+
+// ShutdownError is returned by Shutdown when the context ends before all asynchronous work has finished.
+// Queued work that had not started is abandoned, running handlers cannot be stopped and keep running.
+type ShutdownError struct {
+	// Abandoned is the number of queued commands or event deliveries that will not be executed
+	Abandoned int
+	// Running is the number of handlers that were still running when the context ended
+	Running int
+	// Err is the error of the context that ended the shutdown
+	Err error
+}
+
+// Error returns a message describing the abandoned work.
+func (e *ShutdownError) Error() string {
+	return fmt.Sprintf("gocqrs: shutdown incomplete, %d queued abandoned and %d still running: %v", e.Abandoned, e.Running, e.Err)
+}
+
+// Unwrap returns the context error, so errors.Is(err, context.DeadlineExceeded) works.
+func (e *ShutdownError) Unwrap() error {
+	return e.Err
+}
+
+// lifecycle tracks the asynchronous work of a bus so it can be drained on shutdown.
+// Work is tracked per bus, so buses sharing a worker pool shut down independently.
+type lifecycle struct {
+	// mu guards closed and orders it with the registration of new work
+	mu sync.Mutex
+	// closed is set once shutdown started, new work is rejected afterwards
+	closed bool
+	// abandoning is set when the shutdown deadline passed, queued work is skipped afterwards
+	abandoning atomic.Bool
+	// inflight counts accepted work that has not finished or been abandoned
+	inflight sync.WaitGroup
+	// queued is the number of accepted tasks that have not started
+	queued atomic.Int64
+	// running is the number of tasks currently executing
+	running atomic.Int64
+}
+
+// begin registers a new task and returns ErrClosed if the bus is shut down.
+// Every successful begin must be followed by running the task returned by track or by calling cancel.
+func (l *lifecycle) begin() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return ErrClosed
+	}
+	l.inflight.Add(1)
+	l.queued.Add(1)
+	return nil
+}
+
+// cancel releases a task registered with begin that could not be submitted.
+func (l *lifecycle) cancel() {
+	l.queued.Add(-1)
+	l.inflight.Done()
+}
+
+// track wraps the work of a task registered with begin.
+// The returned function runs the work, or calls abandon instead once the shutdown deadline has passed.
+func (l *lifecycle) track(run, abandon func()) func() {
+	return func() {
+		l.queued.Add(-1)
+		defer l.inflight.Done()
+		if l.abandoning.Load() {
+			abandon()
+			return
+		}
+		l.running.Add(1)
+		defer l.running.Add(-1)
+		run()
+	}
+}
+
+// submit registers the work and queues it on the pool.
+// With a limiter the work only starts once it holds a slot, it counts as queued while it waits.
+// Work that cannot be queued is released again and the pool's error is returned.
+func (l *lifecycle) submit(ctx context.Context, pool *WorkerPool, limiter *concurrencyLimiter, run, abandon func()) error {
+	if err := l.begin(); err != nil {
+		return err
+	}
+	task := l.track(run, abandon)
+	if limiter != nil {
+		tracked := task
+		task = func() {
+			limiter.run(pool, tracked)
+		}
+	}
+	if err := pool.Submit(ctx, task); err != nil {
+		l.cancel()
+		return err
+	}
+	return nil
+}
+
+// shutdown stops accepting work and waits until all accepted work has finished or ctx is done.
+// When ctx ends first, queued work is abandoned and a *ShutdownError reports what did not complete.
+func (l *lifecycle) shutdown(ctx context.Context) error {
+	l.mu.Lock()
+	l.closed = true
+	l.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		l.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		l.abandoning.Store(true)
+		return &ShutdownError{
+			Abandoned: int(l.queued.Load()),
+			Running:   int(l.running.Load()),
+			Err:       ctx.Err(),
+		}
+	}
+}
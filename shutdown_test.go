@@ -0,0 +1,100 @@
+package gocqrs
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCommandBusShutdownDrains(t *testing.T) {
+	var handled atomic.Int64
+	commandBus := DefaultCommandBus(DefaultSyncEventBus())
+	commandBus.SetWorkerPool(NewWorkerPool(WorkerPoolConfig{Workers: 2, QueueSize: 100}))
+	RegisterCommand(commandBus, func(ctx context.Context, c testCommand) ([]Event, error) {
+		time.Sleep(time.Millisecond)
+		handled.Add(1)
+		return nil, nil
+	})
+
+	for i := 0; i < 20; i++ {
+		commandBus.Dispatch(testCommand{})
+	}
+	if err := commandBus.Close(); err != nil {
+		t.Fatalf("Expected a complete shutdown, got %v", err)
+	}
+	if handled.Load() != 20 {
+		t.Errorf("Expected 20 handled commands, got %d", handled.Load())
+	}
+
+	if err := commandBus.TryDispatch(testCommand{}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed after shutdown, got %v", err)
+	}
+	if err := commandBus.TryExecute(testCommand{}); err != nil {
+		t.Errorf("Expected synchronous execution to keep working, got %v", err)
+	}
+}
+
+func TestCommandBusShutdownDeadline(t *testing.T) {
+	release := make(chan struct{})
+	commandBus := DefaultCommandBus(DefaultSyncEventBus())
+	commandBus.SetWorkerPool(NewWorkerPool(WorkerPoolConfig{Workers: 1, QueueSize: 10}))
+	RegisterCommand(commandBus, func(ctx context.Context, c testCommand) ([]Event, error) {
+		<-release
+		return nil, nil
+	})
+
+	running := commandBus.DispatchAsync(context.Background(), testCommand{})
+	var queued []*Future
+	for i := 0; i < 3; i++ {
+		queued = append(queued, commandBus.DispatchAsync(context.Background(), testCommand{}))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := commandBus.Shutdown(ctx)
+
+	var shutdownErr *ShutdownError
+	if !errors.As(err, &shutdownErr) {
+		t.Fatalf("Expected a ShutdownError, got %v", err)
+	}
+	if shutdownErr.Abandoned != 3 || shutdownErr.Running != 1 {
+		t.Errorf("Expected 3 abandoned and 1 running, got %d and %d", shutdownErr.Abandoned, shutdownErr.Running)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the context error to be wrapped, got %v", err)
+	}
+
+	close(release)
+	if _, err := running.Wait(context.Background()); err != nil {
+		t.Errorf("Expected the running command to complete, got %v", err)
+	}
+	for _, future := range queued {
+		if _, err := future.Wait(context.Background()); !errors.Is(err, ErrClosed) {
+			t.Errorf("Expected abandoned commands to resolve with ErrClosed, got %v", err)
+		}
+	}
+}
+
+func TestEventBusShutdownDrains(t *testing.T) {
+	var handled atomic.Int64
+	eventBus := DefaultAsyncEventBus()
+	eventBus.Register("TestEvent", func(e Event) {
+		time.Sleep(time.Millisecond)
+		handled.Add(1)
+	})
+
+	for i := 0; i < 10; i++ {
+		eventBus.Dispatch(testEvent{})
+	}
+	if err := eventBus.Close(); err != nil {
+		t.Fatalf("Expected a complete shutdown, got %v", err)
+	}
+	if handled.Load() != 10 {
+		t.Errorf("Expected 10 handled events, got %d", handled.Load())
+	}
+	if err := eventBus.TryDispatch(testEvent{}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed after shutdown, got %v", err)
+	}
+}
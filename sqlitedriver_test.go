@@ -0,0 +1,6 @@
+//go:build cgo
+
+package gocqrs
+
+// The SQLite event store tests run against this driver, it needs cgo.
+import _ "github.com/mattn/go-sqlite3"
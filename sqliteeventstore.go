@@ -0,0 +1,283 @@
+package gocqrs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SQLiteEventStoreConfig configures a SQLiteEventStore.
+// Zero values are replaced by the defaults of DefaultSQLiteEventStoreConfig.
+type SQLiteEventStoreConfig struct {
+	// Serializer converts events to payloads and back
+	Serializer *EventSerializer
+	// Table is the name of the table holding the events, it is created if it does not exist
+	Table string
+}
+
+// DefaultSQLiteEventStoreConfig returns the configuration used for zero values of SQLiteEventStoreConfig.
+// It uses DefaultEventSerializer and stores the events in a table named events.
+func DefaultSQLiteEventStoreConfig() SQLiteEventStoreConfig {
+	return SQLiteEventStoreConfig{Serializer: DefaultEventSerializer(), Table: "events"}
+}
+
+// sqliteEventStoreSchema creates the events table. Positions are assigned by AUTOINCREMENT, so they increase
+// monotonically and are never reused, and the unique stream version makes conflicting appends fail.
+const sqliteEventStoreSchema = `CREATE TABLE IF NOT EXISTS %s (
+	position       INTEGER PRIMARY KEY AUTOINCREMENT,
+	stream_id      TEXT    NOT NULL,
+	version        INTEGER NOT NULL,
+	event_id       TEXT    NOT NULL,
+	event_type     TEXT    NOT NULL,
+	schema_version INTEGER NOT NULL,
+	codec          TEXT    NOT NULL,
+	payload        BLOB    NOT NULL,
+	occurred_at    TEXT    NOT NULL,
+	correlation_id TEXT    NOT NULL,
+	causation_id   TEXT    NOT NULL,
+	metadata       TEXT,
+	UNIQUE (stream_id, version)
+)`
+
+// sqliteEventColumns lists the columns read for an event, in the order scanned by SQLiteEventStore.query.
+const sqliteEventColumns = "position, stream_id, version, event_id, event_type, schema_version, codec, payload, occurred_at, correlation_id, causation_id, metadata"
+
+// SQLiteEventStore is an EventStore backed by a SQLite database accessed through database/sql.
+// The library does not depend on a driver, the application imports one (such as modernc.org/sqlite or
+// github.com/mattn/go-sqlite3) and passes the opened database.
+//
+// Each append runs in a single transaction whose first statement inserts the first event only if the stream is at
+// the expected version, so the check takes SQLite's write lock and concurrent appends, even from different processes,
+// are serialized and rejected with ErrConcurrencyConflict. Waiting for the lock needs a busy timeout: go-sqlite3 waits
+// five seconds by default, modernc.org/sqlite needs the busy_timeout pragma, otherwise appends can fail with the
+// driver's busy error.
+type SQLiteEventStore struct {
+	// db is the database holding the events
+	db *sql.DB
+	// config holds the store configuration with defaults applied
+	config SQLiteEventStoreConfig
+	// table is the quoted name of the events table
+	table string
+}
+
+// OpenSQLiteEventStore creates an event store in the database, creating the events table if it does not exist.
+// The database is not closed by the store.
+func OpenSQLiteEventStore(ctx context.Context, db *sql.DB, config SQLiteEventStoreConfig) (*SQLiteEventStore, error) {
+	defaults := DefaultSQLiteEventStoreConfig()
+	if config.Serializer == nil {
+		config.Serializer = defaults.Serializer
+	}
+	if config.Table == "" {
+		config.Table = defaults.Table
+	}
+	s := &SQLiteEventStore{
+		db:     db,
+		config: config,
+		table:  `"` + strings.ReplaceAll(config.Table, `"`, `""`) + `"`,
+	}
+	if _, err := db.ExecContext(ctx, fmt.Sprintf(sqliteEventStoreSchema, s.table)); err != nil {
+		return nil, fmt.Errorf("gocqrs: create events table: %w", err)
+	}
+	return s, nil
+}
+
+// Append adds the envelopes to the end of the stream in a single transaction if it is at the expected version.
+func (s *SQLiteEventStore) Append(ctx context.Context, streamID string, expectedVersion int64, envelopes ...Envelope) ([]RecordedEvent, error) {
+	if len(envelopes) == 0 {
+		version, err := s.version(ctx, s.db, streamID)
+		if err != nil {
+			return nil, err
+		}
+		return nil, checkVersion(streamID, expectedVersion, version)
+	}
+	// The versions are assigned once the current version of the stream is known
+	recorded := recordEnvelopes(ctx, streamID, 0, 0, envelopes)
+	stored, err := s.encode(recorded)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// The first event is only inserted if the stream is at the expected version, and gets the version after it.
+	// Being a write, the statement takes the write lock before the stream is read.
+	columns := strings.TrimPrefix(sqliteEventColumns, "position, ")
+	result, err := tx.ExecContext(ctx, "INSERT INTO "+s.table+" ("+columns+") SELECT ?, current + 1, ?, ?, ?, ?, ?, ?, ?, ?, ? "+
+		"FROM (SELECT COALESCE(MAX(version), 0) AS current FROM "+s.table+" WHERE stream_id = ?) WHERE ? IN (?, current)",
+		slices.Concat(stored[0][:1], stored[0][2:], []any{streamID, expectedVersion, AnyVersion})...)
+	if err != nil {
+		return nil, s.insertError(ctx, tx, streamID, expectedVersion, err)
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if inserted == 0 {
+		return nil, s.conflict(ctx, tx, streamID, expectedVersion)
+	}
+	position, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	version := expectedVersion + 1
+	if expectedVersion == AnyVersion {
+		if err := tx.QueryRowContext(ctx, "SELECT version FROM "+s.table+" WHERE position = ?", position).Scan(&version); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range recorded {
+		recorded[i].Version += version - 1
+	}
+	recorded[0].Position = position
+	if len(recorded) > 1 {
+		stmt, err := tx.PrepareContext(ctx, "INSERT INTO "+s.table+" ("+columns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+		if err != nil {
+			return nil, err
+		}
+		defer stmt.Close()
+		for i := 1; i < len(recorded); i++ {
+			stored[i][1] = recorded[i].Version
+			result, err := stmt.ExecContext(ctx, stored[i]...)
+			if err != nil {
+				return nil, s.insertError(ctx, tx, streamID, expectedVersion, err)
+			}
+			if recorded[i].Position, err = result.LastInsertId(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return recorded, nil
+}
+
+// encode converts the events to the column values of their rows, in the order of sqliteEventColumns
+// without the position. The versions are filled in when the events are inserted.
+func (s *SQLiteEventStore) encode(recorded []RecordedEvent) ([][]any, error) {
+	rows := make([][]any, len(recorded))
+	for i, event := range recorded {
+		stored, err := encodeEnvelope(event.Envelope, s.config.Serializer)
+		if err != nil {
+			return nil, err
+		}
+		var metadata sql.NullString
+		if len(stored.Metadata) > 0 {
+			data, err := json.Marshal(stored.Metadata)
+			if err != nil {
+				return nil, err
+			}
+			metadata = sql.NullString{String: string(data), Valid: true}
+		}
+		rows[i] = []any{stored.AggregateID, nil, stored.ID, stored.EventType, stored.SchemaVersion, stored.codec(), stored.payload(),
+			stored.Timestamp.Format(time.RFC3339Nano), stored.CorrelationID, stored.CausationID, metadata}
+	}
+	return rows, nil
+}
+
+// sqlQuerier is implemented by *sql.DB and *sql.Tx.
+type sqlQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// version returns the current version of the stream, zero if it does not exist.
+func (s *SQLiteEventStore) version(ctx context.Context, q sqlQuerier, streamID string) (int64, error) {
+	var version int64
+	err := q.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM "+s.table+" WHERE stream_id = ?", streamID).Scan(&version)
+	return version, err
+}
+
+// conflict returns the *ConcurrencyError of an append that found the stream at another version than expected.
+func (s *SQLiteEventStore) conflict(ctx context.Context, tx *sql.Tx, streamID string, expectedVersion int64) error {
+	version, err := s.version(ctx, tx, streamID)
+	if err != nil {
+		return err
+	}
+	return &ConcurrencyError{StreamID: streamID, Expected: expectedVersion, Actual: version}
+}
+
+// insertError converts the unique constraint error of an insert into a *ConcurrencyError. The version check
+// prevents such errors, the constraint still guards the streams against writers bypassing this store.
+func (s *SQLiteEventStore) insertError(ctx context.Context, tx *sql.Tx, streamID string, expectedVersion int64, err error) error {
+	if isUniqueViolation(err) {
+		return s.conflict(ctx, tx, streamID, expectedVersion)
+	}
+	return err
+}
+
+// isUniqueViolation reports whether err is SQLite's unique constraint error.
+// The drivers do not share an error type, but all of them include SQLite's message.
+func isUniqueViolation(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+// ReadStreamForward returns up to limit events of the stream starting at fromVersion, oldest first.
+func (s *SQLiteEventStore) ReadStreamForward(ctx context.Context, streamID string, fromVersion int64, limit int) ([]RecordedEvent, error) {
+	return s.query(ctx, "WHERE stream_id = ? AND version >= ? ORDER BY version LIMIT ?", streamID, fromVersion, sqliteLimit(limit))
+}
+
+// ReadStreamBackward returns up to limit events of the stream starting at fromVersion, newest first.
+func (s *SQLiteEventStore) ReadStreamBackward(ctx context.Context, streamID string, fromVersion int64, limit int) ([]RecordedEvent, error) {
+	return s.query(ctx, "WHERE stream_id = ? AND version <= ? ORDER BY version DESC LIMIT ?", streamID, fromVersion, sqliteLimit(limit))
+}
+
+// ReadAll returns up to limit events of all streams starting at the global position fromPosition.
+func (s *SQLiteEventStore) ReadAll(ctx context.Context, fromPosition int64, limit int) ([]RecordedEvent, error) {
+	return s.query(ctx, "WHERE position >= ? ORDER BY position LIMIT ?", fromPosition, sqliteLimit(limit))
+}
+
+// sqliteLimit converts a read limit into a LIMIT value, SQLite treats a negative limit as no limit.
+func sqliteLimit(limit int) int {
+	if limit <= 0 {
+		return -1
+	}
+	return limit
+}
+
+// query reads the events selected by the given clauses and decodes them.
+func (s *SQLiteEventStore) query(ctx context.Context, clauses string, args ...any) ([]RecordedEvent, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+sqliteEventColumns+" FROM "+s.table+" "+clauses, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []RecordedEvent
+	for rows.Next() {
+		var stored storedEnvelope
+		var position int64
+		var codec string
+		var payload []byte
+		var occurredAt string
+		var metadata sql.NullString
+		err := rows.Scan(&position, &stored.AggregateID, &stored.Version, &stored.ID, &stored.EventType, &stored.SchemaVersion, &codec, &payload,
+			&occurredAt, &stored.CorrelationID, &stored.CausationID, &metadata)
+		if err != nil {
+			return nil, err
+		}
+		stored.setPayload(codec, payload)
+		if stored.Timestamp, err = time.Parse(time.RFC3339Nano, occurredAt); err != nil {
+			return nil, fmt.Errorf("gocqrs: event %s: %w", stored.ID, err)
+		}
+		if metadata.Valid {
+			if err := json.Unmarshal([]byte(metadata.String), &stored.Metadata); err != nil {
+				return nil, fmt.Errorf("gocqrs: event %s: %w", stored.ID, err)
+			}
+		}
+		env, err := stored.decode(s.config.Serializer)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, RecordedEvent{Envelope: env, Position: position})
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,107 @@
+package gocqrs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// sqliteDriver returns the name of a SQLite driver linked into the test binary, or an empty string.
+// The library does not depend on a driver, the tests link go-sqlite3 when cgo is available.
+func sqliteDriver() string {
+	drivers := sql.Drivers()
+	for _, name := range []string{"sqlite", "sqlite3"} {
+		if slices.Contains(drivers, name) {
+			return name
+		}
+	}
+	return ""
+}
+
+func openTestSQLiteEventStore(t *testing.T, driver, path string) *SQLiteEventStore {
+	t.Helper()
+	db, err := sql.Open(driver, path)
+	if err != nil {
+		t.Fatalf("Expected database to open, got %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	store, err := OpenSQLiteEventStore(context.Background(), db, SQLiteEventStoreConfig{Serializer: newTestSerializer(JSONCodec)})
+	if err != nil {
+		t.Fatalf("Expected event store to open, got %v", err)
+	}
+	return store
+}
+
+func TestSQLiteEventStore(t *testing.T) {
+	driver := sqliteDriver()
+	if driver == "" {
+		t.Skip("no SQLite driver registered with database/sql")
+	}
+	testEventStoreContract(t, func(t *testing.T) EventStore {
+		return openTestSQLiteEventStore(t, driver, filepath.Join(t.TempDir(), "events.db"))
+	})
+}
+
+func TestSQLiteEventStoreConcurrentConnections(t *testing.T) {
+	driver := sqliteDriver()
+	if driver == "" {
+		t.Skip("no SQLite driver registered with database/sql")
+	}
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "events.db")
+	// Two databases act like two processes sharing the file
+	stores := []*SQLiteEventStore{openTestSQLiteEventStore(t, driver, path), openTestSQLiteEventStore(t, driver, path)}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created := 0
+	for i := range 16 {
+		store := stores[i%2]
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := store.Append(ctx, "user-1", AnyVersion, Envelope{Event: testEvent{}}); err != nil {
+				t.Errorf("Expected append with any version to succeed, got %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := store.Append(ctx, "user-2", NoStream, Envelope{Event: testEvent{}})
+			if err == nil {
+				mu.Lock()
+				created++
+				mu.Unlock()
+			} else if !errors.Is(err, ErrConcurrencyConflict) {
+				t.Errorf("Expected concurrency conflict, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if events, err := stores[0].ReadStreamForward(ctx, "user-1", 1, 0); err != nil || len(events) != 16 || events[15].Version != 16 {
+		t.Errorf("Expected 16 consecutive events, got %d and %v", len(events), err)
+	}
+	if created != 1 {
+		t.Errorf("Expected exactly one append to create the stream, got %d", created)
+	}
+}
+
+func TestIsUniqueViolation(t *testing.T) {
+	tests := map[string]bool{
+		"UNIQUE constraint failed: events.stream_id, events.version":                           true,
+		"constraint failed: UNIQUE constraint failed: events.stream_id, events.version (2067)": true,
+		"database is locked (5) (SQLITE_BUSY)":                                                 false,
+	}
+	for message, expected := range tests {
+		if got := isUniqueViolation(errors.New(message)); got != expected {
+			t.Errorf("Expected %v for %q, got %v", expected, message, got)
+		}
+	}
+	if isUniqueViolation(nil) {
+		t.Error("Expected nil not to be a unique violation")
+	}
+}
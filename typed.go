@@ -0,0 +1,152 @@
+package gocqrs
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// RegisterQuery registers a typed handler function for queries of type Q on the given query bus.
+// The handler receives the query already converted to Q, so no type assertion is needed.
+// Queries sent as a pointer to Q, or as the value when Q is a pointer type, are converted as well.
+// Its result is stored as the QueryResult payload and can be retrieved with Ask.
+func RegisterQuery[Q Query, R any](bus QueryBus, handler func(ctx context.Context, q Q) (R, error)) {
+	var q Q
+	bus.Register(q, queryHandlerFunc[Q, R](handler))
+}
+
+// Ask executes a query on the given query bus and returns its payload as R.
+// An unsuccessful result is returned as an error wrapping ErrHandlerFailed, which also wraps the payload if it is
+// an error. Returns ErrTypeMismatch if the handler produced a payload of a different type,
+// and any error reported by the bus or the handler otherwise.
+func Ask[R any, Q Query](ctx context.Context, bus QueryBus, q Q) (R, error) {
+	var zero R
+	result, err := bus.AskContext(ctx, q)
+	if err != nil {
+		return zero, err
+	}
+	if !result.Success {
+		if payloadErr, ok := result.Payload.(error); ok {
+			return zero, fmt.Errorf("%w for query %T: %w", ErrHandlerFailed, q, payloadErr)
+		}
+		return zero, fmt.Errorf("%w for query %T: unsuccessful result %v", ErrHandlerFailed, q, result.Payload)
+	}
+	if result.Payload == nil {
+		return zero, nil
+	}
+	payload, ok := result.Payload.(R)
+	if !ok {
+		return zero, fmt.Errorf("%w: query %T returned %T, expected %T", ErrTypeMismatch, q, result.Payload, zero)
+	}
+	return payload, nil
+}
+
+// RegisterCommand registers a typed handler function for commands of type C on the given command bus.
+// The handler receives the command already converted to C and returns the events it produced.
+// Commands sent as a pointer to C, or as the value when C is a pointer type, are converted as well.
+// Each execution collects its own events, so the function can safely be executed concurrently.
+func RegisterCommand[C Command](bus CommandBus, handler func(ctx context.Context, c C) ([]Event, error)) {
+	var c C
+	bus.Register(c, commandHandlerFunc[C](handler))
+}
+
+// Subscribe registers a typed handler function for events of type E on the given event bus.
+// The event type is taken from the GetEventType method of the zero value of E,
+// so it must not depend on the event's fields.
+// For pointer types the method is called on a pointer to a zero value, so value receivers work as well.
+// It panics with ErrInvalidType if E is an interface type. The returned Subscription removes the handler again.
+func Subscribe[E Event](bus EventBus, handler func(ctx context.Context, e E) error) Subscription {
+	var zero E
+	t := reflect.TypeFor[E]()
+	if t.Kind() == reflect.Interface {
+		panic(fmt.Errorf("%w: event type %s is an interface", ErrInvalidType, t))
+	}
+	eventType := newEventValue(t).Interface().(Event).GetEventType()
+	return bus.RegisterContext(eventType, func(ctx context.Context, e Event) error {
+		typed, ok := convertMessage[E](e)
+		if !ok {
+			return fmt.Errorf("%w: received event %T, expected %T", ErrTypeMismatch, e, zero)
+		}
+		return handler(ctx, typed)
+	})
+}
+
+// queryHandlerFunc adapts a typed query handler function to the QueryHandler interface.
+// It implements ContextQueryHandler so the bus passes the context through.
+type queryHandlerFunc[Q Query, R any] func(ctx context.Context, q Q) (R, error)
+
+// Handle executes the query with a background context.
+// A failure is reported as an unsuccessful result carrying the error as payload.
+func (f queryHandlerFunc[Q, R]) Handle(q Query) QueryResult {
+	result, err := f.HandleContext(context.Background(), q)
+	if err != nil {
+		return QueryResult{Payload: err, Success: false}
+	}
+	return result
+}
+
+// HandleContext converts the query to Q and calls the wrapped function.
+// Returns ErrTypeMismatch if the query is not of type Q.
+func (f queryHandlerFunc[Q, R]) HandleContext(ctx context.Context, q Query) (QueryResult, error) {
+	typed, ok := convertMessage[Q](q)
+	if !ok {
+		var zero Q
+		return QueryResult{}, fmt.Errorf("%w: received query %T, expected %T", ErrTypeMismatch, q, zero)
+	}
+	payload, err := f(ctx, typed)
+	if err != nil {
+		return QueryResult{Success: false}, err
+	}
+	return QueryResult{Payload: payload, Success: true}, nil
+}
+
+// commandHandlerFunc adapts a typed command handler function to the CommandHandler interface.
+// It implements ContextCommandHandler so the bus passes the context through.
+type commandHandlerFunc[C Command] func(ctx context.Context, c C) ([]Event, error)
+
+// isolated marks commandHandlerFunc as keeping no state between executions.
+func (f commandHandlerFunc[C]) isolated() {}
+
+// Handle executes the command with a background context.
+// Events are only returned when the function succeeds, as Handle cannot report the error.
+func (f commandHandlerFunc[C]) Handle(c Command) CommandHandler {
+	ch, err := f.HandleContext(context.Background(), c)
+	if err != nil {
+		return collectedEvents(nil)
+	}
+	return ch
+}
+
+// CollectEvents returns no events, the events of an execution are returned by Handle and HandleContext.
+func (f commandHandlerFunc[C]) CollectEvents() []Event {
+	return nil
+}
+
+// HandleContext converts the command to C and calls the wrapped function.
+// The returned handler holds only the events produced by this execution.
+func (f commandHandlerFunc[C]) HandleContext(ctx context.Context, c Command) (CommandHandler, error) {
+	typed, ok := convertMessage[C](c)
+	if !ok {
+		var zero C
+		return nil, fmt.Errorf("%w: received command %T, expected %T", ErrTypeMismatch, c, zero)
+	}
+	events, err := f(ctx, typed)
+	if err != nil {
+		return nil, err
+	}
+	return collectedEvents(events), nil
+}
+
+// collectedEvents is a CommandHandler that only carries the events of a single execution.
+// It is returned by handlers that do not keep events in their own state.
+type collectedEvents []Event
+
+// Handle returns the events unchanged, collectedEvents does not handle commands itself.
+func (e collectedEvents) Handle(c Command) CommandHandler {
+	return e
+}
+
+// CollectEvents returns the events produced by the execution.
+func (e collectedEvents) CollectEvents() []Event {
+	return e
+}
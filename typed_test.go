@@ -0,0 +1,108 @@
+package gocqrs
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTypedQuery(t *testing.T) {
+	queryBus := DefaultQueryBus()
+	RegisterQuery(queryBus, func(ctx context.Context, q testQuery) (int, error) {
+		if q.ID < 0 {
+			return 0, errors.New("negative id")
+		}
+		return q.ID * 2, nil
+	})
+
+	result, err := Ask[int](context.Background(), queryBus, testQuery{ID: 21})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result != 42 {
+		t.Errorf("Expected 42, got %d", result)
+	}
+
+	if _, err := Ask[int](context.Background(), queryBus, testQuery{ID: -1}); !errors.Is(err, ErrHandlerFailed) {
+		t.Errorf("Expected ErrHandlerFailed, got %v", err)
+	}
+
+	if _, err := Ask[string](context.Background(), queryBus, testQuery{ID: 1}); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch, got %v", err)
+	}
+}
+
+type failingQueryHandler struct {
+	payload any
+}
+
+func (h *failingQueryHandler) Handle(q Query) QueryResult {
+	return QueryResult{Payload: h.payload, Success: false}
+}
+
+func TestAskUnsuccessfulResult(t *testing.T) {
+	queryBus := DefaultQueryBus()
+	queryBus.Register(testQuery{}, &failingQueryHandler{payload: "User not found"})
+
+	if payload, err := Ask[string](context.Background(), queryBus, testQuery{ID: 1}); !errors.Is(err, ErrHandlerFailed) || payload != "" {
+		t.Errorf("Expected ErrHandlerFailed for an unsuccessful result, got %q and %v", payload, err)
+	}
+
+	notFound := errors.New("user not found")
+	queryBus.Register(testQuery{}, &failingQueryHandler{payload: notFound})
+	if _, err := Ask[string](context.Background(), queryBus, testQuery{ID: 1}); !errors.Is(err, ErrHandlerFailed) || !errors.Is(err, notFound) {
+		t.Errorf("Expected the error payload to be wrapped, got %v", err)
+	}
+}
+
+func TestTypedCommandAndSubscribe(t *testing.T) {
+	var received []string
+	eventBus := DefaultSyncEventBus()
+	Subscribe(eventBus, func(ctx context.Context, e testEvent) error {
+		received = append(received, e.Name)
+		return nil
+	})
+
+	commandBus := DefaultCommandBus(eventBus)
+	RegisterCommand(commandBus, func(ctx context.Context, c testCommand) ([]Event, error) {
+		return []Event{testEvent{Name: c.Name}}, nil
+	})
+
+	if err := commandBus.TryExecute(testCommand{Name: "first"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := commandBus.TryExecute(testCommand{Name: "second"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(received) != 2 || received[0] != "first" || received[1] != "second" {
+		t.Errorf("Expected events [first second], got %v", received)
+	}
+}
+
+func TestSubscribePointerEvent(t *testing.T) {
+	var received []string
+	eventBus := DefaultSyncEventBus()
+	// testEvent has a value receiver, GetEventType must not be called on a nil pointer
+	Subscribe(eventBus, func(ctx context.Context, e *testEvent) error {
+		received = append(received, e.Name)
+		return nil
+	})
+
+	if err := eventBus.TryDispatch(&testEvent{Name: "pointer"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := eventBus.TryDispatch(testEvent{Name: "value"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(received) != 2 || received[0] != "pointer" || received[1] != "value" {
+		t.Errorf("Expected events [pointer value], got %v", received)
+	}
+
+	defer func() {
+		if err, _ := recover().(error); !errors.Is(err, ErrInvalidType) {
+			t.Errorf("Expected ErrInvalidType for an interface type, got %v", err)
+		}
+	}()
+	Subscribe(eventBus, func(ctx context.Context, e Event) error { return nil })
+}
@@ -0,0 +1,126 @@
+package gocqrs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrTransactionFailed is returned when the transaction of a command could not be begun, committed or rolled back.
+// The returned error also wraps the error reported by the Transaction or TransactionHook.
+var ErrTransactionFailed = errors.New("gocqrs: transaction failed")
+
+// Transaction is a user-supplied transaction that spans all handlers of a command in unit-of-work mode,
+// for example a wrapper around *sql.Tx.
+type Transaction interface {
+	// Commit makes the changes of the handlers permanent.
+	// It is called once all handlers succeeded, before any event is published.
+	Commit(ctx context.Context) error
+
+	// Rollback discards the changes of the handlers.
+	// It is called when a handler fails or panics, or the context is done before all handlers have run.
+	Rollback(ctx context.Context) error
+}
+
+// TransactionHook begins the transaction of a command executed in unit-of-work mode.
+// It receives the context of the command, including its CommandEnvelope.
+type TransactionHook func(ctx context.Context) (Transaction, error)
+
+// transactionKey is the context key of the transaction of the command being handled.
+type transactionKey struct{}
+
+// TransactionFromContext returns the transaction of the command being handled.
+// Handlers use it to make their changes within the transaction begun by the TransactionHook.
+func TransactionFromContext(ctx context.Context) (Transaction, bool) {
+	tx, ok := ctx.Value(transactionKey{}).(Transaction)
+	return tx, ok
+}
+
+// SetUnitOfWork enables or disables unit-of-work mode.
+// In unit-of-work mode all handlers of a command run before any event is published. Their events are buffered
+// and published only if every handler succeeded, they are discarded if one of them fails.
+// Combined with SetTransactionHook the handlers share a transaction that is committed before the events are published.
+func (d *defaultCommandBus) SetUnitOfWork(enabled bool) {
+	d.update(func(r *commandRegistry) {
+		r.unitOfWork = enabled
+	})
+}
+
+// SetTransactionHook sets the hook that begins a transaction for every command executed in unit-of-work mode.
+// The transaction is available to middleware-wrapped handlers through TransactionFromContext.
+// The hook is not called outside of unit-of-work mode. Passing nil removes the hook.
+func (d *defaultCommandBus) SetTransactionHook(hook TransactionHook) {
+	d.update(func(r *commandRegistry) {
+		r.transactionHook = hook
+	})
+}
+
+// runUnitOfWork executes the command on every handler within a transaction begun by the transaction hook, if any.
+// The collected events are buffered and only published once all handlers succeeded and the transaction
+// was committed. Otherwise the transaction is rolled back, also when a handler panics, and the events are discarded.
+// The events are saved to the outbox within the transaction, before it is committed. An outbox implementing
+// OutboxDiscarder drops the saved events again if the transaction fails. The event store cannot take part in the
+// transaction, so the events are only appended to it once the transaction committed. If that append fails, the command
+// fails with the handlers' changes committed and the events are dropped from an outbox implementing OutboxDiscarder.
+func (d *defaultCommandBus) runUnitOfWork(ctx context.Context, registry *commandRegistry, t reflect.Type, handlers []*commandRegistration, c Command, metadata map[string]string, dispatched *[]Event) (err error) {
+	var tx Transaction
+	txCtx := ctx
+	if hook := registry.transactionHook; hook != nil {
+		if tx, err = hook(ctx); err != nil {
+			return fmt.Errorf("%w: begin: %w", ErrTransactionFailed, err)
+		}
+		txCtx = context.WithValue(ctx, transactionKey{}, tx)
+	}
+	// saved holds the envelopes saved to the outbox, which must be discarded unless the transaction commits
+	var saved []Envelope
+	rollback, committed := tx != nil, false
+	defer func() {
+		if committed {
+			return
+		}
+		cleanupCtx := context.WithoutCancel(txCtx)
+		if rollback {
+			if rollbackErr := tx.Rollback(cleanupCtx); rollbackErr != nil {
+				err = errors.Join(err, fmt.Errorf("%w: rollback: %w", ErrTransactionFailed, rollbackErr))
+			}
+		}
+		if discardErr := registry.discard(cleanupCtx, saved); discardErr != nil {
+			err = errors.Join(err, discardErr)
+		}
+	}()
+
+	var buffered []Event
+	for _, reg := range handlers {
+		if err := txCtx.Err(); err != nil {
+			return err
+		}
+		events, err := reg.execute(txCtx, c)
+		if err != nil {
+			return handlerError("command", typeName(t), err)
+		}
+		buffered = append(buffered, events...)
+	}
+
+	envelopes := newEnvelopes(txCtx, buffered, metadata)
+	if err := registry.save(txCtx, envelopes); err != nil {
+		return err
+	}
+	saved = envelopes
+	if tx != nil {
+		// A failed commit is not rolled back, the transaction is already finished
+		rollback = false
+		if err := tx.Commit(txCtx); err != nil {
+			return fmt.Errorf("%w: commit: %w", ErrTransactionFailed, err)
+		}
+	}
+	committed = true
+	if err := registry.store(ctx, envelopes); err != nil {
+		return errors.Join(err, registry.discard(context.WithoutCancel(ctx), envelopes))
+	}
+	if registry.outbox != nil {
+		*dispatched = append(*dispatched, buffered...)
+		return nil
+	}
+	return errors.Join(d.publish(ctx, envelopes, dispatched)...)
+}
@@ -0,0 +1,130 @@
+package gocqrs
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+type testTransaction struct {
+	log       *[]string
+	commitErr error
+}
+
+func (tx *testTransaction) Commit(ctx context.Context) error {
+	*tx.log = append(*tx.log, "commit")
+	return tx.commitErr
+}
+
+func (tx *testTransaction) Rollback(ctx context.Context) error {
+	*tx.log = append(*tx.log, "rollback")
+	return nil
+}
+
+func newUnitOfWorkBus(log *[]string, commitErr error) *defaultCommandBus {
+	eventBus := DefaultSyncEventBus()
+	eventBus.Register("TestEvent", func(e Event) {
+		*log = append(*log, "event")
+	})
+	commandBus := DefaultCommandBus(eventBus)
+	commandBus.SetUnitOfWork(true)
+	commandBus.SetTransactionHook(func(ctx context.Context) (Transaction, error) {
+		*log = append(*log, "begin")
+		return &testTransaction{log: log, commitErr: commitErr}, nil
+	})
+	return commandBus
+}
+
+func TestUnitOfWorkPublishesAfterCommit(t *testing.T) {
+	var log []string
+	commandBus := newUnitOfWorkBus(&log, nil)
+
+	var inTransaction int
+	for range 2 {
+		RegisterCommand(commandBus, func(ctx context.Context, c testCommand) ([]Event, error) {
+			if _, ok := TransactionFromContext(ctx); ok {
+				inTransaction++
+			}
+			return []Event{testEvent{Name: c.Name}}, nil
+		})
+	}
+
+	if err := commandBus.TryExecute(testCommand{Name: "John"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if want := []string{"begin", "commit", "event", "event"}; !slices.Equal(log, want) {
+		t.Errorf("Expected %v, got %v", want, log)
+	}
+	if inTransaction != 2 {
+		t.Errorf("Expected both handlers to run in the transaction, got %d", inTransaction)
+	}
+}
+
+func TestUnitOfWorkDiscardsEventsOnFailure(t *testing.T) {
+	var log []string
+	commandBus := newUnitOfWorkBus(&log, nil)
+
+	handlerErr := errors.New("second handler failed")
+	commandBus.Register(testCommand{}, &testCommandHandler{})
+	commandBus.Register(testCommand{}, &failingCommandHandler{err: handlerErr})
+
+	outcome, err := commandBus.DispatchAsync(context.Background(), testCommand{Name: "John"}).Wait(context.Background())
+	if !errors.Is(err, handlerErr) {
+		t.Errorf("Expected handler error, got %v", err)
+	}
+	if len(outcome.Events) != 0 {
+		t.Errorf("Expected no dispatched events, got %v", outcome.Events)
+	}
+	if want := []string{"begin", "rollback"}; !slices.Equal(log, want) {
+		t.Errorf("Expected %v, got %v", want, log)
+	}
+}
+
+func TestUnitOfWorkRollsBackOnPanic(t *testing.T) {
+	var log []string
+	commandBus := newUnitOfWorkBus(&log, nil)
+	RegisterCommand(commandBus, func(ctx context.Context, c testCommand) ([]Event, error) {
+		panic("boom")
+	})
+
+	var panicErr *PanicError
+	if err := commandBus.TryExecute(testCommand{}); !errors.As(err, &panicErr) {
+		t.Errorf("Expected *PanicError, got %v", err)
+	}
+	if want := []string{"begin", "rollback"}; !slices.Equal(log, want) {
+		t.Errorf("Expected %v, got %v", want, log)
+	}
+}
+
+func TestUnitOfWorkCommitFailure(t *testing.T) {
+	var log []string
+	commitErr := errors.New("serialization failure")
+	commandBus := newUnitOfWorkBus(&log, commitErr)
+	commandBus.Register(testCommand{}, &testCommandHandler{})
+
+	err := commandBus.TryExecute(testCommand{})
+	if !errors.Is(err, ErrTransactionFailed) || !errors.Is(err, commitErr) {
+		t.Errorf("Expected wrapped commit error, got %v", err)
+	}
+	if want := []string{"begin", "commit"}; !slices.Equal(log, want) {
+		t.Errorf("Expected %v, got %v", want, log)
+	}
+}
+
+func TestUnitOfWorkCommitFailureLeavesEventStoreEmpty(t *testing.T) {
+	var log []string
+	store := NewMemoryEventStore()
+	commandBus := newUnitOfWorkBus(&log, errors.New("serialization failure"))
+	commandBus.SetEventStore(store)
+	RegisterCommand(commandBus, func(ctx context.Context, c openAccount) ([]Event, error) {
+		return []Event{accountOpened{AccountID: c.AccountID, Version: 1}}, nil
+	})
+
+	if err := commandBus.TryExecute(openAccount{AccountID: "acc-1"}); !errors.Is(err, ErrTransactionFailed) {
+		t.Fatalf("Expected commit error, got %v", err)
+	}
+	if events, _ := store.ReadAll(context.Background(), 1, 0); len(events) != 0 {
+		t.Errorf("Expected no stored events after a failed commit, got %+v", events)
+	}
+}
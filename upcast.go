@@ -0,0 +1,107 @@
+package gocqrs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrUnsupportedSchemaVersion is returned when a stored event cannot be brought to the current schema version
+// of its type, because an upcaster is missing or the event was stored by a newer version of the application.
+var ErrUnsupportedSchemaVersion = errors.New("gocqrs: unsupported schema version")
+
+// VersionedEvent is an optional interface an Event implements once its payload layout changed.
+// The schema version is stored with every event, events read back with an older version are converted
+// by the upcasters registered with RegisterUpcaster before they are decoded.
+// Events that do not implement it have schema version 1.
+type VersionedEvent interface {
+	Event
+
+	// SchemaVersion returns the version of the event's payload layout, starting at 1.
+	// It must not depend on the values of the event's fields.
+	SchemaVersion() int
+}
+
+// schemaVersion returns the schema version of the event.
+func schemaVersion(e Event) int {
+	if ve, ok := e.(VersionedEvent); ok {
+		return max(ve.SchemaVersion(), 1)
+	}
+	return 1
+}
+
+// Upcaster converts an event payload from one schema version to the next.
+// It receives the payload as encoded by the codec the event was stored with, usually JSON.
+type Upcaster func(payload []byte) ([]byte, error)
+
+// upcasterKey identifies the upcaster of an event type from a schema version.
+type upcasterKey struct {
+	// eventType is the event type the upcaster converts
+	eventType string
+	// fromVersion is the schema version the upcaster converts from
+	fromVersion int
+}
+
+// RegisterUpcaster registers an upcaster converting payloads of the event type from fromVersion to fromVersion+1
+// in the default registry. Upcasters are chained, a v1 event of a v3 type runs through the upcasters from
+// version 1 and 2. It panics if fromVersion is less than 1 or an upcaster is already registered for it.
+func RegisterUpcaster(eventType string, fromVersion int, upcaster Upcaster) {
+	defaultEventTypes.RegisterUpcaster(eventType, fromVersion, upcaster)
+}
+
+// RegisterUpcaster registers an upcaster in the registry, see the RegisterUpcaster function.
+func (r *EventTypeRegistry) RegisterUpcaster(eventType string, fromVersion int, upcaster Upcaster) {
+	err := r.update(func(types *eventTypes) error {
+		key := upcasterKey{eventType: eventType, fromVersion: fromVersion}
+		if fromVersion < 1 {
+			return fmt.Errorf("%w: upcaster for %s from version %d", ErrUnsupportedSchemaVersion, eventType, fromVersion)
+		}
+		if _, ok := types.upcasters[key]; ok {
+			return fmt.Errorf("gocqrs: upcaster for %s from version %d registered twice", eventType, fromVersion)
+		}
+		types.upcasters[key] = upcaster
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// upcast runs the payload of the event type through the upcasters from the given schema version
+// to the current schema version of the event type.
+func (t *eventTypes) upcast(eventType string, version int, payload []byte) ([]byte, error) {
+	current := t.versions[eventType]
+	if version > current {
+		return nil, fmt.Errorf("%w: %s has version %d, newer than the current version %d",
+			ErrUnsupportedSchemaVersion, eventType, version, current)
+	}
+	for ; version < current; version++ {
+		upcaster, ok := t.upcasters[upcasterKey{eventType: eventType, fromVersion: version}]
+		if !ok {
+			return nil, fmt.Errorf("%w: no upcaster for %s from version %d", ErrUnsupportedSchemaVersion, eventType, version)
+		}
+		var err error
+		if payload, err = upcaster(payload); err != nil {
+			return nil, fmt.Errorf("gocqrs: upcast %s from version %d: %w", eventType, version, err)
+		}
+	}
+	return payload, nil
+}
+
+// UpcastJSON returns an Upcaster for JSON payloads that lets fn change the fields of the event object,
+// such as renaming, splitting or adding fields. Numbers are decoded as json.Number to keep their precision.
+func UpcastJSON(fn func(fields map[string]any) error) Upcaster {
+	return func(payload []byte) ([]byte, error) {
+		decoder := json.NewDecoder(bytes.NewReader(payload))
+		decoder.UseNumber()
+		var fields map[string]any
+		if err := decoder.Decode(&fields); err != nil {
+			return nil, err
+		}
+		if err := fn(fields); err != nil {
+			return nil, err
+		}
+		return json.Marshal(fields)
+	}
+}
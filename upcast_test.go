@@ -0,0 +1,132 @@
+package gocqrs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// customerRegistered is at schema version 3. Version 1 had a single name and a mail field,
+// version 2 split the name into first and last name and version 3 renamed mail to email.
+type customerRegistered struct {
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Email     string `json:"email"`
+}
+
+func (e customerRegistered) GetEventType() string {
+	return "CustomerRegistered"
+}
+
+func (e customerRegistered) SchemaVersion() int {
+	return 3
+}
+
+// newCustomerSerializer creates a serializer for customerRegistered with the upcasters of its older versions.
+func newCustomerSerializer() *EventSerializer {
+	types := NewEventTypeRegistry()
+	RegisterEventTypeIn[customerRegistered](types)
+	types.RegisterUpcaster("CustomerRegistered", 1, UpcastJSON(func(fields map[string]any) error {
+		name, _ := fields["name"].(string)
+		fields["firstName"], fields["lastName"], _ = strings.Cut(name, " ")
+		delete(fields, "name")
+		return nil
+	}))
+	types.RegisterUpcaster("CustomerRegistered", 2, UpcastJSON(func(fields map[string]any) error {
+		fields["email"] = fields["mail"]
+		delete(fields, "mail")
+		return nil
+	}))
+	return NewEventSerializer(types, nil)
+}
+
+var expectedCustomers = []customerRegistered{
+	{FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com"},
+	{FirstName: "Grace", LastName: "Hopper", Email: "grace@example.com"},
+	{FirstName: "Alan", LastName: "Turing", Email: "alan@example.com"},
+}
+
+func TestUpcastOutboxFixture(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "customer-outbox.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	store, err := OpenFileOutboxStore(path, newCustomerSerializer())
+	if err != nil {
+		t.Fatalf("Expected outbox to open, got %v", err)
+	}
+	defer store.Close()
+
+	envelopes, err := store.Pending(context.Background(), 10)
+	if err != nil || len(envelopes) != len(expectedCustomers) {
+		t.Fatalf("Expected %d pending events, got %d and %v", len(expectedCustomers), len(envelopes), err)
+	}
+	for i, env := range envelopes {
+		if env.Event != expectedCustomers[i] || env.SchemaVersion != 3 {
+			t.Errorf("Expected %+v at version 3, got %+v at version %d", expectedCustomers[i], env.Event, env.SchemaVersion)
+		}
+	}
+}
+
+func TestUpcastEventStoreFixture(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.CopyFS(dir, os.DirFS(filepath.Join("testdata", "customer-events"))); err != nil {
+		t.Fatal(err)
+	}
+	// The fixture has no index files, opening the store rebuilds them from the last segment
+	store := openTestEventStore(t, dir, FileEventStoreConfig{Serializer: newCustomerSerializer()})
+	ctx := context.Background()
+
+	events, err := store.ReadAll(ctx, 1, 0)
+	if err != nil || len(events) != len(expectedCustomers) {
+		t.Fatalf("Expected %d events, got %d and %v", len(expectedCustomers), len(events), err)
+	}
+	for i, event := range events {
+		if event.Event != expectedCustomers[i] {
+			t.Errorf("Expected %+v, got %+v", expectedCustomers[i], event.Event)
+		}
+	}
+	stream, err := store.ReadStreamForward(ctx, "customer-1", 1, 0)
+	if err != nil || len(stream) != 1 || stream[0].Event != expectedCustomers[0] {
+		t.Errorf("Expected upcast event in stream, got %+v and %v", stream, err)
+	}
+
+	recorded, err := store.Append(ctx, "customer-4", NoStream, Envelope{Event: customerRegistered{FirstName: "Barbara"}})
+	if err != nil || recorded[0].SchemaVersion != 3 {
+		t.Errorf("Expected new events at the current version, got %+v and %v", recorded, err)
+	}
+}
+
+func TestUpcastErrors(t *testing.T) {
+	types := NewEventTypeRegistry()
+	RegisterEventTypeIn[customerRegistered](types)
+	serializer := NewEventSerializer(types, nil)
+
+	_, err := serializer.DeserializeVersion("CustomerRegistered", 2, []byte(`{"firstName":"Grace"}`))
+	if !errors.Is(err, ErrUnsupportedSchemaVersion) {
+		t.Errorf("Expected missing upcaster to fail, got %v", err)
+	}
+	_, err = serializer.DeserializeVersion("CustomerRegistered", 4, []byte(`{}`))
+	if !errors.Is(err, ErrUnsupportedSchemaVersion) {
+		t.Errorf("Expected newer schema version to fail, got %v", err)
+	}
+	if e, err := serializer.DeserializeVersion("CustomerRegistered", 3, []byte(`{"firstName":"Alan"}`)); err != nil || e.(customerRegistered).FirstName != "Alan" {
+		t.Errorf("Expected current version to decode as is, got %v and %v", e, err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected duplicate upcaster to panic")
+		}
+	}()
+	upcaster := func(payload []byte) ([]byte, error) { return payload, nil }
+	types.RegisterUpcaster("CustomerRegistered", 1, upcaster)
+	types.RegisterUpcaster("CustomerRegistered", 1, upcaster)
+}
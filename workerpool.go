@@ -0,0 +1,261 @@
+package gocqrs
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+// ErrQueueFull is returned when work is submitted to a full worker pool
+// whose backpressure policy is BackpressureError.
+var ErrQueueFull = errors.New("gocqrs: worker pool queue is full")
+
+// ErrDropped is reported when work was discarded because the worker pool queue was full
+// and its backpressure policy is BackpressureDrop.
+// Fire-and-forget dispatches drop work silently, a Future resolves with this error.
+var ErrDropped = errors.New("gocqrs: work dropped by worker pool")
+
+// BackpressurePolicy determines what a worker pool does when its queue is full.
+type BackpressurePolicy int
+
+const (
+	// BackpressureBlock makes the submitter wait until the queue has room or its context is done.
+	BackpressureBlock BackpressurePolicy = iota
+	// BackpressureDrop discards the submitted work.
+	BackpressureDrop
+	// BackpressureError rejects the submitted work with ErrQueueFull.
+	BackpressureError
+)
+
+// WorkerPoolConfig configures a WorkerPool.
+// Zero values are replaced by the defaults of DefaultWorkerPoolConfig.
+type WorkerPoolConfig struct {
+	// Workers is the maximum number of goroutines executing work concurrently
+	Workers int
+	// QueueSize is the number of submitted tasks that can wait for a free worker
+	QueueSize int
+	// Policy determines what happens when work is submitted while the queue is full
+	Policy BackpressurePolicy
+}
+
+// DefaultWorkerPoolConfig returns the configuration used by the buses when no worker pool is set.
+// It allows four workers per available CPU, queues up to 1024 tasks and blocks submitters when full.
+func DefaultWorkerPoolConfig() WorkerPoolConfig {
+	return WorkerPoolConfig{
+		Workers:   4 * runtime.GOMAXPROCS(0),
+		QueueSize: 1024,
+		Policy:    BackpressureBlock,
+	}
+}
+
+// WorkerPool executes asynchronous commands and events on a bounded number of goroutines.
+// Workers are started on demand and exit when the queue is empty, so an idle pool holds no goroutines.
+// A pool can be shared by several buses.
+type WorkerPool struct {
+	// config holds the pool configuration with defaults applied
+	config WorkerPoolConfig
+	// tasks is the bounded queue of submitted work
+	tasks chan func()
+	// mu guards workers and requeued
+	mu sync.Mutex
+	// workers is the number of running worker goroutines
+	workers int
+	// requeued holds accepted tasks that were put back by requeue, they run before the queued tasks
+	requeued []func()
+}
+
+// NewWorkerPool creates a worker pool with the given configuration.
+func NewWorkerPool(config WorkerPoolConfig) *WorkerPool {
+	defaults := DefaultWorkerPoolConfig()
+	if config.Workers <= 0 {
+		config.Workers = defaults.Workers
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaults.QueueSize
+	}
+	return &WorkerPool{
+		config: config,
+		tasks:  make(chan func(), config.QueueSize),
+	}
+}
+
+// Submit queues the task for execution by a worker.
+// When the queue is full the pool applies its backpressure policy: BackpressureBlock waits until there is room
+// or ctx is done, BackpressureDrop returns ErrDropped and BackpressureError returns ErrQueueFull.
+func (p *WorkerPool) Submit(ctx context.Context, task func()) error {
+	select {
+	case p.tasks <- task:
+	default:
+		switch p.config.Policy {
+		case BackpressureDrop:
+			return ErrDropped
+		case BackpressureError:
+			return ErrQueueFull
+		default:
+			select {
+			case p.tasks <- task:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	p.startWorker()
+	return nil
+}
+
+// startWorker starts a new worker goroutine unless the maximum number of workers is running.
+func (p *WorkerPool) startWorker() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.workers >= p.config.Workers {
+		return
+	}
+	p.workers++
+	go p.work()
+}
+
+// requeue puts back a task the pool already accepted, such as a command that waited for a concurrency limit.
+// It bypasses the queue bound and the backpressure policy, as the task was admitted before.
+func (p *WorkerPool) requeue(task func()) {
+	p.mu.Lock()
+	p.requeued = append(p.requeued, task)
+	p.mu.Unlock()
+	p.startWorker()
+}
+
+// nextRequeued removes and returns the oldest requeued task, or nil if there is none.
+func (p *WorkerPool) nextRequeued() func() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.requeued) == 0 {
+		return nil
+	}
+	task := p.requeued[0]
+	p.requeued = slices.Delete(p.requeued, 0, 1)
+	return task
+}
+
+// work runs requeued and queued tasks until both are empty.
+// The queues are checked again under the lock before exiting,
+// so a task submitted while the worker stops is never left without a worker.
+func (p *WorkerPool) work() {
+	for {
+		if task := p.nextRequeued(); task != nil {
+			task()
+			continue
+		}
+		select {
+		case task := <-p.tasks:
+			task()
+		default:
+			p.mu.Lock()
+			if len(p.tasks) > 0 || len(p.requeued) > 0 {
+				p.mu.Unlock()
+				continue
+			}
+			p.workers--
+			p.mu.Unlock()
+			return
+		}
+	}
+}
+
+// concurrencyLimiter bounds the number of concurrent executions of a command type.
+// Asynchronous executions waiting for a slot are parked instead of blocking a pool worker,
+// so they cannot starve other work sharing the pool.
+type concurrencyLimiter struct {
+	// mu guards active and waiters
+	mu sync.Mutex
+	// limit is the maximum number of executions holding a slot
+	limit int
+	// active is the number of executions holding a slot
+	active int
+	// waiters holds the executions waiting for a slot, in arrival order
+	waiters []*limitWaiter
+}
+
+// limitWaiter is an execution waiting for a slot of a concurrencyLimiter.
+// A synchronous execution waits for ready to be closed, an asynchronous one is requeued on its pool.
+type limitWaiter struct {
+	// ready is closed when a slot is handed to a synchronous execution, nil for asynchronous ones
+	ready chan struct{}
+	// task runs an asynchronous execution holding the slot
+	task func()
+	// pool is the worker pool the asynchronous execution was submitted to
+	pool *WorkerPool
+}
+
+// newConcurrencyLimiter creates a limiter allowing limit concurrent executions.
+func newConcurrencyLimiter(limit int) *concurrencyLimiter {
+	return &concurrencyLimiter{limit: limit}
+}
+
+// acquire waits for a slot until ctx is done. It is used by synchronous executions,
+// which wait on the goroutine of their caller. Every successful acquire must be followed by release.
+func (l *concurrencyLimiter) acquire(ctx context.Context) error {
+	l.mu.Lock()
+	if l.active < l.limit {
+		l.active++
+		l.mu.Unlock()
+		return nil
+	}
+	w := &limitWaiter{ready: make(chan struct{})}
+	l.waiters = append(l.waiters, w)
+	l.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		i := slices.Index(l.waiters, w)
+		if i >= 0 {
+			l.waiters = slices.Delete(l.waiters, i, i+1)
+		}
+		l.mu.Unlock()
+		if i < 0 {
+			// The slot was handed over while the context ended, pass it on
+			l.release()
+		}
+		return ctx.Err()
+	}
+}
+
+// run executes the task of an asynchronous execution on the current worker if a slot is free.
+// Otherwise the task is parked and the worker is freed, it is requeued on pool once a slot is handed to it.
+// The slot is released when the task returns.
+func (l *concurrencyLimiter) run(pool *WorkerPool, task func()) {
+	holding := func() {
+		defer l.release()
+		task()
+	}
+	l.mu.Lock()
+	if l.active >= l.limit {
+		l.waiters = append(l.waiters, &limitWaiter{task: holding, pool: pool})
+		l.mu.Unlock()
+		return
+	}
+	l.active++
+	l.mu.Unlock()
+	holding()
+}
+
+// release frees a slot, handing it directly to the oldest waiting execution if there is one.
+func (l *concurrencyLimiter) release() {
+	l.mu.Lock()
+	if len(l.waiters) == 0 {
+		l.active--
+		l.mu.Unlock()
+		return
+	}
+	w := l.waiters[0]
+	l.waiters = slices.Delete(l.waiters, 0, 1)
+	l.mu.Unlock()
+	if w.ready != nil {
+		close(w.ready)
+		return
+	}
+	w.pool.requeue(w.task)
+}
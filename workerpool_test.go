@@ -0,0 +1,161 @@
+package gocqrs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolBoundsConcurrency(t *testing.T) {
+	pool := NewWorkerPool(WorkerPoolConfig{Workers: 3, QueueSize: 100})
+
+	var running, maxRunning atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		err := pool.Submit(context.Background(), func() {
+			defer wg.Done()
+			n := running.Add(1)
+			for {
+				m := maxRunning.Load()
+				if n <= m || maxRunning.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			running.Add(-1)
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	wg.Wait()
+
+	if maxRunning.Load() > 3 {
+		t.Errorf("Expected at most 3 concurrent tasks, got %d", maxRunning.Load())
+	}
+}
+
+func TestWorkerPoolBackpressurePolicies(t *testing.T) {
+	tests := []struct {
+		policy   BackpressurePolicy
+		expected error
+	}{
+		{BackpressureError, ErrQueueFull},
+		{BackpressureDrop, ErrDropped},
+		{BackpressureBlock, context.DeadlineExceeded},
+	}
+
+	for _, test := range tests {
+		pool := NewWorkerPool(WorkerPoolConfig{Workers: 1, QueueSize: 1, Policy: test.policy})
+		release := make(chan struct{})
+		started := make(chan struct{})
+
+		// Occupy the only worker, then fill the queue
+		pool.Submit(context.Background(), func() {
+			close(started)
+			<-release
+		})
+		<-started
+		pool.Submit(context.Background(), func() {})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		err := pool.Submit(ctx, func() {})
+		cancel()
+		close(release)
+
+		if !errors.Is(err, test.expected) {
+			t.Errorf("Policy %d: expected %v, got %v", test.policy, test.expected, err)
+		}
+	}
+}
+
+func TestCommandBusConcurrencyLimit(t *testing.T) {
+	var running, maxRunning atomic.Int64
+	commandBus := DefaultCommandBus(DefaultSyncEventBus())
+	RegisterCommand(commandBus, func(ctx context.Context, c testCommand) ([]Event, error) {
+		n := running.Add(1)
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		running.Add(-1)
+		return nil, nil
+	})
+	commandBus.SetConcurrencyLimit(testCommand{}, 2)
+
+	var futures []*Future
+	for i := 0; i < 20; i++ {
+		futures = append(futures, commandBus.DispatchAsync(context.Background(), testCommand{}))
+	}
+	for _, future := range futures {
+		if _, err := future.Wait(context.Background()); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	if maxRunning.Load() > 2 {
+		t.Errorf("Expected at most 2 concurrent executions, got %d", maxRunning.Load())
+	}
+}
+
+type limitedTestCommand struct{}
+
+func TestConcurrencyLimitDoesNotStarvePool(t *testing.T) {
+	release := make(chan struct{})
+	commandBus := DefaultCommandBus(DefaultSyncEventBus())
+	commandBus.SetWorkerPool(NewWorkerPool(WorkerPoolConfig{Workers: 2}))
+	RegisterCommand(commandBus, func(ctx context.Context, c limitedTestCommand) ([]Event, error) {
+		<-release
+		return nil, nil
+	})
+	RegisterCommand(commandBus, func(ctx context.Context, c testCommand) ([]Event, error) {
+		return nil, nil
+	})
+	commandBus.SetConcurrencyLimit(limitedTestCommand{}, 1)
+
+	// One command holds the only slot, the two waiting ones must not occupy the second worker
+	var limited []*Future
+	for i := 0; i < 3; i++ {
+		limited = append(limited, commandBus.DispatchAsync(context.Background(), limitedTestCommand{}))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := commandBus.DispatchAsync(ctx, testCommand{}).Wait(ctx); err != nil {
+		t.Fatalf("Expected another command type to make progress, got %v", err)
+	}
+
+	close(release)
+	for _, future := range limited {
+		if _, err := future.Wait(ctx); err != nil {
+			t.Errorf("Expected limited commands to complete, got %v", err)
+		}
+	}
+}
+
+func TestDispatchAsyncQueueFull(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	commandBus := DefaultCommandBus(DefaultSyncEventBus())
+	commandBus.SetWorkerPool(NewWorkerPool(WorkerPoolConfig{Workers: 1, QueueSize: 1, Policy: BackpressureError}))
+	RegisterCommand(commandBus, func(ctx context.Context, c testCommand) ([]Event, error) {
+		<-release
+		return nil, nil
+	})
+
+	var lastErr error
+	for i := 0; i < 5; i++ {
+		if outcome, done := commandBus.DispatchAsync(context.Background(), testCommand{}).Outcome(); done {
+			lastErr = outcome.Err
+		}
+	}
+	if !errors.Is(lastErr, ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull, got %v", lastErr)
+	}
+}